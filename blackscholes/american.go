@@ -0,0 +1,279 @@
+package blackscholes
+
+import (
+	"math"
+	"strings"
+)
+
+const (
+	AmericanBAW    = "baw"    // Barone-Adesi-Whaley (1987)
+	AmericanBS2002 = "bs2002" // Bjerksund-Stensland (2002)
+
+	bawMaxExecTimes = 100
+	bawEpsilon      = 1e-6
+)
+
+// 美式期权解析近似定价, 用于对速度要求较高的实时报价
+// see: Haug, The Complete Guide to Option Pricing Formulas, chapter 3
+type American struct {
+	Method    string  `json:"method"`        // 近似方法 baw / bs2002
+	D         string  `json:"direction"`     // direction 期权方向 看涨：c 看跌：p
+	S         float64 `json:"subject_price"` // subjectPrice期权标的价格（指数价格）
+	X         float64 `json:"strike_price"`  // 期权行权价格（敲定价格）
+	T         float64 `json:"rest_time"`     // （期权到期日-当前时间）/365天
+	R         float64 `json:"price_rate"`    // 计价币种的利率
+	Q         float64 `json:"dividend_rate"` // 标的连续分红率/外币利率
+	Iv        float64 `json:"volatility"`    // 年化波动率
+	IvMax     float64 `json:"iv_max"`        // 年化波动最大值
+	IvMin     float64 `json:"iv_min"`        // 年化波动最小
+	Op        float64 `json:"option_price"`  // 期权报价
+	OpEpsilon float64 `json:"op_epsilon"`    // 价格精度0.0001
+	Price     float64 `json:"price"`         // 按Iv计算的美式期权价格
+}
+
+func NewAmerican(method string, direction string, S float64, X float64, T float64, r float64, q float64, op float64, opEpsilon float64, ivMax float64, ivMin float64) *American {
+	a := American{
+		Method:    strings.ToLower(method),
+		D:         strings.ToLower(direction),
+		S:         S,
+		X:         X,
+		T:         T,
+		R:         r,
+		Q:         q,
+		Op:        op,
+		OpEpsilon: opEpsilon,
+		IvMax:     ivMax,
+		IvMin:     ivMin,
+	}
+	a.Init()
+	return &a
+}
+
+func NewAmericanWithIv(method string, direction string, S float64, X float64, T float64, r float64, q float64, op float64, opEpsilon float64, ivMax float64, ivMin float64, iv float64) *American {
+	a := American{
+		Method:    strings.ToLower(method),
+		D:         strings.ToLower(direction),
+		S:         S,
+		X:         X,
+		T:         T,
+		R:         r,
+		Q:         q,
+		Op:        op,
+		OpEpsilon: opEpsilon,
+		Iv:        iv,
+		IvMax:     ivMax,
+		IvMin:     ivMin,
+	}
+	a.Init()
+	return &a
+}
+
+func (a *American) Init() {
+	// 计算波动率, 失败时Iv保持为0
+	if a.Iv == 0 {
+		if _, err := a.ImVolBisection(); err == nil {
+			return
+		}
+	}
+	// Iv不为正(求解失败)时不计算价格
+	if a.Iv <= 0 {
+		return
+	}
+	a.Price = a.GetOptionPriceFromIv(a.Iv)
+}
+
+// 割线法+二分法求隐含波动率, 仅在求解成功时更新Iv并重新计算
+func (a *American) ImVolBisection() (*IvResult, error) {
+	res, err := solveBisection(a.Op, a.OpEpsilon, a.IvMax, a.IvMin, a.GetOptionPriceFromIv)
+	if err != nil {
+		return res, err
+	}
+	a.Iv = res.Iv
+	a.Init()
+	return res, nil
+}
+
+// 通过隐含波动率找到对应的期权报价
+func (a *American) GetOptionPriceFromIv(iv float64) float64 {
+	if a.Method == AmericanBS2002 {
+		if a.D == "c" {
+			return bs2002Call(a.S, a.X, a.T, a.R, a.R-a.Q, iv)
+		} else if a.D == "p" {
+			// put-call transformation: P(S, X, T, r, b) = C(X, S, T, r-b, -b)
+			return bs2002Call(a.X, a.S, a.T, a.Q, a.Q-a.R, iv)
+		}
+		return 0
+	}
+	if a.D == "c" {
+		return bawCall(a.S, a.X, a.T, a.R, a.R-a.Q, iv)
+	} else if a.D == "p" {
+		return bawPut(a.S, a.X, a.T, a.R, a.R-a.Q, iv)
+	}
+	return 0
+}
+
+// 持有成本为b的欧式期权价格
+func europeanPrice(direction string, S, X, T, r, b, iv float64) float64 {
+	bsm := BSM{D: direction, S: S, X: X, T: T, R: r, Q: r - b}
+	return bsm.GetOptionPriceFromIv(iv)
+}
+
+func d1(S, X, T, b, iv float64) float64 {
+	return (math.Log(S/X) + (b+iv*iv/2)*T) / (iv * math.Sqrt(T))
+}
+
+// r趋于0时 2r/(v^2(1-e^(-rT))) 的极限为 2/(v^2 T)
+func bawK(T, r, iv float64) float64 {
+	if math.Abs(r) < 1e-12 {
+		return 2 / (iv * iv * T)
+	}
+	return 2 * r / (iv * iv * (1 - math.Exp(-r*T)))
+}
+
+func bawCall(S, X, T, r, b, iv float64) float64 {
+	if b >= r {
+		return europeanPrice("c", S, X, T, r, b, iv)
+	}
+	sk := bawCriticalCall(X, T, r, b, iv)
+	n := 2 * b / (iv * iv)
+	k := bawK(T, r, iv)
+	q2 := (-(n - 1) + math.Sqrt((n-1)*(n-1)+4*k)) / 2
+	a2 := (sk / q2) * (1 - math.Exp((b-r)*T)*Cdf(d1(sk, X, T, b, iv)))
+	if S < sk {
+		return europeanPrice("c", S, X, T, r, b, iv) + a2*math.Pow(S/sk, q2)
+	}
+	return S - X
+}
+
+func bawPut(S, X, T, r, b, iv float64) float64 {
+	if r <= 0 {
+		return europeanPrice("p", S, X, T, r, b, iv)
+	}
+	sk := bawCriticalPut(X, T, r, b, iv)
+	n := 2 * b / (iv * iv)
+	k := bawK(T, r, iv)
+	q1 := (-(n - 1) - math.Sqrt((n-1)*(n-1)+4*k)) / 2
+	a1 := -(sk / q1) * (1 - math.Exp((b-r)*T)*Cdf(-d1(sk, X, T, b, iv)))
+	if S > sk {
+		return europeanPrice("p", S, X, T, r, b, iv) + a1*math.Pow(S/sk, q1)
+	}
+	return X - S
+}
+
+// 牛顿法求看涨期权的提前行权临界价格
+func bawCriticalCall(X, T, r, b, iv float64) float64 {
+	n := 2 * b / (iv * iv)
+	m := 2 * r / (iv * iv)
+	q2u := (-(n - 1) + math.Sqrt((n-1)*(n-1)+4*m)) / 2
+	su := X / (1 - 1/q2u)
+	h2 := -(b*T + 2*iv*math.Sqrt(T)) * X / (su - X)
+	si := X + (su-X)*(1-math.Exp(h2))
+
+	k := bawK(T, r, iv)
+	q2 := (-(n - 1) + math.Sqrt((n-1)*(n-1)+4*k)) / 2
+	ebrt := math.Exp((b - r) * T)
+	for i := 0; i < bawMaxExecTimes; i++ {
+		d := d1(si, X, T, b, iv)
+		lhs := si - X
+		rhs := europeanPrice("c", si, X, T, r, b, iv) + (1-ebrt*Cdf(d))*si/q2
+		if math.Abs(lhs-rhs)/X < bawEpsilon {
+			break
+		}
+		bi := ebrt*Cdf(d)*(1-1/q2) + (1-ebrt*nd(d)/(iv*math.Sqrt(T)))/q2
+		si = (X + rhs - bi*si) / (1 - bi)
+	}
+	return si
+}
+
+// 牛顿法求看跌期权的提前行权临界价格
+func bawCriticalPut(X, T, r, b, iv float64) float64 {
+	n := 2 * b / (iv * iv)
+	m := 2 * r / (iv * iv)
+	q1u := (-(n - 1) - math.Sqrt((n-1)*(n-1)+4*m)) / 2
+	su := X / (1 - 1/q1u)
+	h1 := (b*T - 2*iv*math.Sqrt(T)) * X / (X - su)
+	si := su + (X-su)*math.Exp(h1)
+
+	k := bawK(T, r, iv)
+	q1 := (-(n - 1) - math.Sqrt((n-1)*(n-1)+4*k)) / 2
+	ebrt := math.Exp((b - r) * T)
+	for i := 0; i < bawMaxExecTimes; i++ {
+		d := d1(si, X, T, b, iv)
+		lhs := X - si
+		rhs := europeanPrice("p", si, X, T, r, b, iv) - (1-ebrt*Cdf(-d))*si/q1
+		if math.Abs(lhs-rhs)/X < bawEpsilon {
+			break
+		}
+		bi := -ebrt*Cdf(-d)*(1-1/q1) - (1+ebrt*nd(-d)/(iv*math.Sqrt(T)))/q1
+		si = (X - rhs + bi*si) / (1 + bi)
+	}
+	return si
+}
+
+func bs2002Call(S, X, T, r, b, iv float64) float64 {
+	if b >= r {
+		return europeanPrice("c", S, X, T, r, b, iv)
+	}
+	v2 := iv * iv
+	t1 := (math.Sqrt(5) - 1) / 2 * T
+	beta := (0.5 - b/v2) + math.Sqrt(math.Pow(b/v2-0.5, 2)+2*r/v2)
+	bInfinity := beta / (beta - 1) * X
+	b0 := math.Max(X, r/(r-b)*X)
+	ht1 := -(b*t1 + 2*iv*math.Sqrt(t1)) * X * X / ((bInfinity - b0) * b0)
+	ht2 := -(b*T + 2*iv*math.Sqrt(T)) * X * X / ((bInfinity - b0) * b0)
+	i1 := b0 + (bInfinity-b0)*(1-math.Exp(ht1))
+	i2 := b0 + (bInfinity-b0)*(1-math.Exp(ht2))
+	alfa1 := (i1 - X) * math.Pow(i1, -beta)
+	alfa2 := (i2 - X) * math.Pow(i2, -beta)
+	if S >= i2 {
+		return S - X
+	}
+
+	phi := func(t, gamma, h, i float64) float64 {
+		return bs2002Phi(S, t, gamma, h, i, r, b, iv)
+	}
+	ksi := func(gamma, h float64) float64 {
+		return bs2002Ksi(S, T, gamma, h, i2, i1, t1, r, b, iv)
+	}
+	return alfa2*math.Pow(S, beta) - alfa2*phi(t1, beta, i2, i2) +
+		phi(t1, 1, i2, i2) - phi(t1, 1, i1, i2) -
+		X*phi(t1, 0, i2, i2) + X*phi(t1, 0, i1, i2) +
+		alfa1*phi(t1, beta, i1, i2) - alfa1*ksi(beta, i1) +
+		ksi(1, i1) - ksi(1, X) -
+		X*ksi(0, i1) + X*ksi(0, X)
+}
+
+func bs2002Phi(S, T, gamma, h, i, r, b, iv float64) float64 {
+	v2 := iv * iv
+	lambda := -r + gamma*b + 0.5*gamma*(gamma-1)*v2
+	kappa := 2*b/v2 + 2*gamma - 1
+	vt := iv * math.Sqrt(T)
+	d := -(math.Log(S/h) + (b+(gamma-0.5)*v2)*T) / vt
+	return math.Exp(lambda*T) * math.Pow(S, gamma) * (Cdf(d) - math.Pow(i/S, kappa)*Cdf(d-2*math.Log(i/S)/vt))
+}
+
+func bs2002Ksi(S, T2, gamma, h, i2, i1, t1, r, b, iv float64) float64 {
+	v2 := iv * iv
+	drift := b + (gamma-0.5)*v2
+	vt1, vt2 := iv*math.Sqrt(t1), iv*math.Sqrt(T2)
+	e1 := (math.Log(S/i1) + drift*t1) / vt1
+	e2 := (math.Log(i2*i2/(S*i1)) + drift*t1) / vt1
+	e3 := (math.Log(S/i1) - drift*t1) / vt1
+	e4 := (math.Log(i2*i2/(S*i1)) - drift*t1) / vt1
+	f1 := (math.Log(S/h) + drift*T2) / vt2
+	f2 := (math.Log(i2*i2/(S*h)) + drift*T2) / vt2
+	f3 := (math.Log(i1*i1/(S*h)) + drift*T2) / vt2
+	f4 := (math.Log(S*i1*i1/(h*i2*i2)) + drift*T2) / vt2
+	rho := math.Sqrt(t1 / T2)
+	lambda := -r + gamma*b + 0.5*gamma*(gamma-1)*v2
+	kappa := 2*b/v2 + 2*gamma - 1
+	return math.Exp(lambda*T2) * math.Pow(S, gamma) * (Cbnd(-e1, -f1, rho) -
+		math.Pow(i2/S, kappa)*Cbnd(-e2, -f2, rho) -
+		math.Pow(i1/S, kappa)*Cbnd(-e3, -f3, -rho) +
+		math.Pow(i1/i2, kappa)*Cbnd(-e4, -f4, -rho))
+}
+
+// standard normal probability density function
+func nd(x float64) float64 {
+	return 1 / math.Sqrt(2*math.Pi) * math.Exp(-x*x/2)
+}
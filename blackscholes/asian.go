@@ -0,0 +1,137 @@
+package blackscholes
+
+import (
+	"math"
+	"strings"
+)
+
+const (
+	AsianGeometric       = "geometric" // 连续几何平均, 解析解
+	AsianTurnbullWakeman = "tw"        // 连续算术平均, Turnbull-Wakeman 矩匹配近似
+)
+
+// 平均价格(亚式)期权, 到期按 [T0, T] 时间窗口内标的平均价格结算, 如结算价为到期前30分钟TWAP
+// 窗口已开始时 T0 < 0, 已实现部分的平均价格为 SA
+// see: Haug, The Complete Guide to Option Pricing Formulas, chapter 4.20
+type Asian struct {
+	Method string  `json:"method"`        // 定价方法 geometric / tw
+	D      string  `json:"direction"`     // direction 期权方向 看涨：c 看跌：p
+	S      float64 `json:"subject_price"` // subjectPrice期权标的价格（指数价格）
+	SA     float64 `json:"realized_avg"`  // 窗口内已实现的平均价格, 窗口未开始时忽略
+	X      float64 `json:"strike_price"`  // 期权行权价格（敲定价格）
+	T      float64 `json:"rest_time"`     // （期权到期日-当前时间）/365天
+	T0     float64 `json:"window_start"`  // （平均窗口开始时间-当前时间）/365天, 已开始时为负数
+	R      float64 `json:"price_rate"`    // 计价币种的利率
+	Q      float64 `json:"dividend_rate"` // 标的连续分红率/外币利率
+	Iv     float64 `json:"volatility"`    // 年化波动率
+	Price  float64 `json:"price"`         // 期权价格
+	Delta  float64 `json:"delta"`         // 希腊值delta
+	Gamma  float64 `json:"gamma"`         // 希腊值gamma
+	Vega   float64 `json:"vega"`          // 希腊值vega
+	Theta  float64 `json:"theta"`         // 希腊值theta, 窗口随日历时间平移, SA不变
+	Rho    float64 `json:"rho"`           // 希腊值rho
+
+	Conventions *Conventions `json:"conventions"` // 希腊值口径, 为nil时使用DefaultConventions
+}
+
+func NewAsian(method string, direction string, S float64, SA float64, X float64, T float64, T0 float64, r float64, q float64, iv float64, conventions ...*Conventions) *Asian {
+	a := Asian{
+		Method: strings.ToLower(method),
+		D:      strings.ToLower(direction),
+		S:      S,
+		SA:     SA,
+		X:      X,
+		T:      T,
+		T0:     T0,
+		R:      r,
+		Q:      q,
+		Iv:     iv,
+	}
+	if len(conventions) > 0 {
+		a.Conventions = conventions[0]
+	}
+	a.Init()
+	return &a
+}
+
+func (a *Asian) Init() {
+	a.Conventions = a.Conventions.withDefaults()
+	a.Price = a.price(a.S, a.T, a.T0, a.R, a.Iv)
+
+	hs, hv, hr := a.S*1e-4, 1e-4, 1e-4
+	up, down := a.price(a.S+hs, a.T, a.T0, a.R, a.Iv), a.price(a.S-hs, a.T, a.T0, a.R, a.Iv)
+	a.Delta = (up - down) / (2 * hs)
+	a.Gamma = (up - 2*a.Price + down) / (hs * hs)
+	a.Vega = (a.price(a.S, a.T, a.T0, a.R, a.Iv+hv) - a.price(a.S, a.T, a.T0, a.R, a.Iv-hv)) / (2 * hv) / a.Conventions.VegaScale
+	ht := math.Min(1e-4, a.T/2)
+	a.Theta = -(a.price(a.S, a.T+ht, a.T0+ht, a.R, a.Iv) - a.price(a.S, a.T-ht, a.T0-ht, a.R, a.Iv)) / (2 * ht) / a.Conventions.DayBasis
+	a.Rho = (a.price(a.S, a.T, a.T0, a.R+hr, a.Iv) - a.price(a.S, a.T, a.T0, a.R-hr, a.Iv)) / (2 * hr) / a.Conventions.RhoScale
+}
+
+// 通过隐含波动率找到对应的期权报价
+func (a *Asian) GetOptionPriceFromIv(iv float64) float64 {
+	a.Iv = iv
+	return a.price(a.S, a.T, a.T0, a.R, iv)
+}
+
+func (a *Asian) price(S, T, T0, r, iv float64) float64 {
+	// 平均值 = (elapsed*SA + (T-tau)*剩余窗口平均值) / L
+	tau := math.Max(T0, 0)
+	L := T - T0
+	elapsed := tau - T0
+	w := (T - tau) / L
+	b := r - a.Q
+	if a.Method == AsianGeometric {
+		return a.geometric(S, T, tau, elapsed/L, w, r, b, iv)
+	}
+
+	// 剩余窗口平均值的行权价格
+	x := (a.X - elapsed/L*a.SA) / w
+	m1 := asianM1(T, tau, b)
+	if x <= 0 {
+		// 必然行权
+		if a.D == "p" {
+			return 0
+		}
+		return w * math.Exp(-r*T) * (S*m1 - x)
+	}
+	m2 := asianM2(T, tau, b, iv)
+	bA := math.Log(m1) / T
+	vA := math.Sqrt(math.Log(m2)/T - 2*bA)
+	return w * europeanPrice(a.D, S, x, T, r, bA, vA)
+}
+
+// 几何平均为对数正态分布, 直接由对数均值与方差定价
+func (a *Asian) geometric(S, T, tau, we, w, r, b, iv float64) float64 {
+	var m float64
+	if we > 0 {
+		m = we * math.Log(a.SA)
+	}
+	m += w * (math.Log(S) + (b-iv*iv/2)*(T+tau)/2)
+	v := w * iv * math.Sqrt(tau+(T-tau)/3)
+	d1 := (m - math.Log(a.X) + v*v) / v
+	d2 := d1 - v
+	dr := math.Exp(-r * T)
+	if a.D == "p" {
+		return dr * (a.X*Cdf(-d2) - math.Exp(m+v*v/2)*Cdf(-d1))
+	}
+	return dr * (math.Exp(m+v*v/2)*Cdf(d1) - a.X*Cdf(d2))
+}
+
+// 窗口 [tau, T] 内算术平均值的一阶矩 / S
+func asianM1(T, tau, b float64) float64 {
+	if math.Abs(b) < 1e-8 {
+		return 1
+	}
+	return (math.Exp(b*T) - math.Exp(b*tau)) / (b * (T - tau))
+}
+
+// 窗口 [tau, T] 内算术平均值的二阶矩 / S^2
+func asianM2(T, tau, b, iv float64) float64 {
+	v2, dt2 := iv*iv, (T-tau)*(T-tau)
+	if math.Abs(b) < 1e-8 {
+		return 2 * (math.Exp(v2*T) - math.Exp(v2*tau)*(1+v2*(T-tau))) / (v2 * v2 * dt2)
+	}
+	return 2*math.Exp((2*b+v2)*T)/((b+v2)*(2*b+v2)*dt2) +
+		2*math.Exp((2*b+v2)*tau)/(b*dt2)*(1/(2*b+v2)-math.Exp(b*(T-tau))/(b+v2))
+}
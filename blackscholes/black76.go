@@ -0,0 +1,162 @@
+package blackscholes
+
+import (
+	"math"
+	"strings"
+)
+
+// Black-76 model, 期货/远期期权定价, 只对到期收益折现
+// see wiki: https://en.wikipedia.org/wiki/Black_model
+type B76 struct {
+	D         string  `json:"direction"`     // direction 期权方向 看涨：c 看跌：p
+	F         float64 `json:"forward_price"` // 期货/远期价格
+	X         float64 `json:"strike_price"`  // 期权行权价格（敲定价格）
+	T         float64 `json:"rest_time"`     // （期权到期日-当前时间）/365天
+	R         float64 `json:"price_rate"`    // 计价币种的利率, 仅用于折现
+	Iv        float64 `json:"volatility"`    // 年化波动率
+	IvMax     float64 `json:"iv_max"`        // 年化波动最大值
+	IvMin     float64 `json:"iv_min"`        // 年化波动最小
+	Op        float64 `json:"option_price"`  // 期权报价
+	OpEpsilon float64 `json:"op_epsilon"`    // 价格精度0.0001
+	D1        float64 `json:"d1"`            // 中间值d1
+	Nd1       float64 `json:"nd1"`           // 中间值nd1
+	D2        float64 `json:"d2"`            // 中间值d2
+	Delta     float64 `json:"delta"`         // 希腊值delta, 期权价格对远期价格的敏感度
+	Gamma     float64 `json:"gamma"`         // 希腊值gamma, delta对远期价格的敏感度
+	Vega      float64 `json:"vega"`          // 希腊值vega, 期权价格对隐含波动率的敏感度
+	Theta     float64 `json:"theta"`         // 希腊值theta, 期权价格对剩余期限的敏感度(远期价格不变)
+	Rho       float64 `json:"rho"`           // 希腊值rho, 期权价格对折现利率的敏感度(远期价格不变)
+
+	// 助力参数
+	ExtractT float64 `json:"-"` // T开方
+	Df       float64 `json:"-"` // 折现因子 e^(-rT)
+}
+
+func NewB76(direction string, F float64, X float64, T float64, r float64, op float64, opEpsilon float64, ivMax float64, ivMin float64) *B76 {
+	b76 := B76{
+		D:         strings.ToLower(direction),
+		F:         F,
+		X:         X,
+		T:         T,
+		R:         r,
+		Op:        op,
+		OpEpsilon: opEpsilon,
+		IvMax:     ivMax,
+		IvMin:     ivMin,
+		ExtractT:  math.Sqrt(T),
+		Df:        math.Exp(-r * T),
+	}
+	b76.Init()
+	return &b76
+}
+
+func NewB76WithIv(direction string, F float64, X float64, T float64, r float64, op float64, opEpsilon float64, ivMax float64, ivMin float64, iv float64) *B76 {
+	b76 := B76{
+		D:         strings.ToLower(direction),
+		F:         F,
+		X:         X,
+		T:         T,
+		R:         r,
+		Op:        op,
+		OpEpsilon: opEpsilon,
+		Iv:        iv,
+		IvMax:     ivMax,
+		IvMin:     ivMin,
+		ExtractT:  math.Sqrt(T),
+		Df:        math.Exp(-r * T),
+	}
+	b76.Init()
+	return &b76
+}
+
+func (b76 *B76) Init() {
+	// 计算波动率, 失败时Iv保持为0
+	if b76.Iv == 0 {
+		if _, err := b76.ImVolBisection(); err == nil {
+			return
+		}
+	}
+	// Iv不为正(求解失败)时不计算希腊值
+	if b76.Iv <= 0 {
+		return
+	}
+
+	b76.calcD1()
+	b76.calcD2()
+	b76.calcNd1()
+	b76.calcDelta()
+	b76.calcGamma()
+	b76.calcVega()
+	b76.calcTheta()
+	b76.calcRho()
+}
+
+// 割线法+二分法求隐含波动率, 仅在求解成功时更新Iv并重新计算
+func (b76 *B76) ImVolBisection() (*IvResult, error) {
+	// GetOptionPriceFromIv 会修改Iv, 在副本上求解
+	b := *b76
+	res, err := solveBisection(b.Op, b.OpEpsilon, b.IvMax, b.IvMin, b.GetOptionPriceFromIv)
+	if err != nil {
+		return res, err
+	}
+	b76.Iv = res.Iv
+	b76.Init()
+	return res, nil
+}
+
+// 通过隐含波动率找到对应的期权报价
+func (b76 *B76) GetOptionPriceFromIv(iv float64) (optionPrice float64) {
+	b76.Iv = iv
+	b76.ExtractT = math.Sqrt(b76.T)
+	b76.Df = math.Exp(-b76.R * b76.T)
+	b76.calcD1()
+	b76.calcD2()
+	return b76.price()
+}
+
+func (b76 *B76) calcD1() {
+	b76.D1 = (math.Log(b76.F/b76.X) + b76.Iv*b76.Iv/2*b76.T) / (b76.Iv * b76.ExtractT)
+}
+
+func (b76 *B76) calcD2() {
+	b76.D2 = b76.D1 - b76.Iv*b76.ExtractT
+}
+
+func (b76 *B76) calcNd1() {
+	b76.Nd1 = 1 / math.Sqrt(2*math.Pi) * math.Exp(-(b76.D1 * b76.D1 / 2))
+}
+
+func (b76 *B76) calcDelta() {
+	if b76.D == "c" {
+		b76.Delta = b76.Df * Cdf(b76.D1)
+	} else if b76.D == "p" {
+		b76.Delta = b76.Df * (Cdf(b76.D1) - 1)
+	}
+}
+
+func (b76 *B76) calcGamma() {
+	b76.Gamma = b76.Df * b76.Nd1 / (b76.F * b76.Iv * b76.ExtractT)
+}
+
+func (b76 *B76) calcVega() {
+	b76.Vega = b76.F * b76.Df * b76.ExtractT * b76.Nd1 / 100
+}
+
+func (b76 *B76) calcTheta() {
+	price := b76.price()
+	b76.Theta = (-b76.F*b76.Df*b76.Nd1*b76.Iv/(2*b76.ExtractT) + b76.R*price) / 365
+}
+
+func (b76 *B76) calcRho() {
+	b76.Rho = -b76.T * b76.price() / 100
+}
+
+// 按当前d1,d2计算期权价格, 不修改Iv
+func (b76 *B76) price() float64 {
+	if b76.D == "c" {
+		return b76.Df * (b76.F*Cdf(b76.D1) - b76.X*Cdf(b76.D2))
+	} else if b76.D == "p" {
+		return b76.Df * (b76.X*Cdf(-b76.D2) - b76.F*Cdf(-b76.D1))
+	}
+	return 0
+}
@@ -1,6 +1,7 @@
 package blackscholes
 
 import (
+	"errors"
 	"math"
 	"strings"
 	"testing"
@@ -74,3 +75,586 @@ func BenchmarkBs(b *testing.B) {
 		bsm.Init()
 	}
 }
+
+func TestNewB76(t *testing.T) {
+	F, X, T, r := 25600.0, 25000.0, 30.0/365, 0.03
+	b76 := NewB76WithIv("c", F, X, T, r, 0, 0.01, 3, 0.01, 0.8)
+	op := b76.GetOptionPriceFromIv(0.8)
+
+	// Black-76 等价于标的为 F*e^(-rT) 的 Black-Scholes
+	bsm := NewBSWithIv("c", F*math.Exp(-r*T), X, T, r, 0, 0.01, 3, 0.01, 0.8)
+	if math.Abs(bsm.GetOptionPriceFromIv(0.8)-op) > 1e-8 {
+		t.Errorf("b76 price %f != bsm price %f", op, bsm.GetOptionPriceFromIv(0.8))
+	}
+
+	// put-call parity: c - p = e^(-rT)(F - X)
+	put := NewB76WithIv("p", F, X, T, r, 0, 0.01, 3, 0.01, 0.8)
+	if math.Abs(op-put.GetOptionPriceFromIv(0.8)-math.Exp(-r*T)*(F-X)) > 1e-8 {
+		t.Errorf("b76 put-call parity fail")
+	}
+
+	b76 = NewB76("c", F, X, T, r, op, 0.0001, 3, 0.01)
+	if math.Abs(b76.Iv-0.8) > 1e-4 {
+		t.Errorf("b76 iv %f != 0.8", b76.Iv)
+	}
+	t.Logf("b76: %+v", b76)
+}
+
+func TestNewBSQ(t *testing.T) {
+	S, X, T, r, q, iv := 1.0850, 1.1000, 90.0/365, 0.05, 0.035, 0.12
+	price := func(d string, S, T, r, q, iv float64) float64 {
+		return NewBSQWithIv(d, S, X, T, r, q, 0, 0.0001, 3, 0.01, iv).GetOptionPriceFromIv(iv)
+	}
+	for _, d := range []string{"c", "p"} {
+		bsm := NewBSQWithIv(d, S, X, T, r, q, 0, 0.0001, 3, 0.01, iv)
+		h := 1e-5
+		delta := (price(d, S+h, T, r, q, iv) - price(d, S-h, T, r, q, iv)) / (2 * h)
+		vega := (price(d, S, T, r, q, iv+h) - price(d, S, T, r, q, iv-h)) / (2 * h) / 100
+		theta := -(price(d, S, T+h, r, q, iv) - price(d, S, T-h, r, q, iv)) / (2 * h) / 365
+		rho := (price(d, S, T, r+h, q, iv) - price(d, S, T, r-h, q, iv)) / (2 * h) / 100
+		phi := (price(d, S, T, r, q+h, iv) - price(d, S, T, r, q-h, iv)) / (2 * h) / 100
+		for name, v := range map[string][2]float64{
+			"delta": {bsm.Delta, delta},
+			"vega":  {bsm.Vega, vega},
+			"theta": {bsm.Theta, theta},
+			"rho":   {bsm.Rho, rho},
+			"phi":   {bsm.Phi, phi},
+		} {
+			if math.Abs(v[0]-v[1]) > 1e-6 {
+				t.Errorf("%s %s: analytic %v, numeric %v", d, name, v[0], v[1])
+			}
+		}
+	}
+
+	// put-call parity: c - p = S*e^(-qT) - X*e^(-rT)
+	c, p := price("c", S, T, r, q, iv), price("p", S, T, r, q, iv)
+	if math.Abs(c-p-(S*math.Exp(-q*T)-X*math.Exp(-r*T))) > 1e-10 {
+		t.Errorf("put-call parity fail, c: %f, p: %f", c, p)
+	}
+
+	bsm := NewBSQ("c", S, X, T, r, q, c, 1e-8, 3, 0.01)
+	if math.Abs(bsm.Iv-iv) > 1e-4 {
+		t.Errorf("bsm iv %f != %f", bsm.Iv, iv)
+	}
+}
+
+func TestNewInverse(t *testing.T) {
+	S, X, T, r, iv := 40579.0, 39680.0, 3.5/365, 0.0, 0.56
+	for _, d := range []string{"c", "p"} {
+		inv := NewInverseWithIv(d, S, X, T, r, 0, 0, 0.00001, 3, 0.01, iv)
+		opCoin := inv.GetOptionPriceFromIv(iv)
+
+		h := 0.01
+		up := NewInverseWithIv(d, S+h, X, T, r, 0, 0, 0.00001, 3, 0.01, iv)
+		down := NewInverseWithIv(d, S-h, X, T, r, 0, 0, 0.00001, 3, 0.01, iv)
+		deltaCoin := S * (up.GetOptionPriceFromIv(iv) - down.GetOptionPriceFromIv(iv)) / (2 * h)
+		if math.Abs(inv.DeltaCoin-deltaCoin) > 1e-6 {
+			t.Errorf("%s delta_coin: analytic %v, numeric %v", d, inv.DeltaCoin, deltaCoin)
+		}
+		gammaCoin := (up.DeltaCoin - down.DeltaCoin) / (2 * h)
+		if math.Abs(inv.GammaCoin-gammaCoin) > 1e-8 {
+			t.Errorf("%s gamma_coin: analytic %v, numeric %v", d, inv.GammaCoin, gammaCoin)
+		}
+
+		inv = NewInverse(d, S, X, T, r, 0, opCoin, 1e-9, 3, 0.01)
+		if math.Abs(inv.Iv-iv) > 1e-4 {
+			t.Errorf("%s inverse iv %f != %f", d, inv.Iv, iv)
+		}
+		t.Logf("inverse: %+v, bsm: %+v", inv, inv.BSM)
+	}
+}
+
+func TestNewLattice(t *testing.T) {
+	S, X, T, r, q, iv := 100.0, 110.0, 0.5, 0.05, 0.02, 0.3
+	for _, d := range []string{"c", "p"} {
+		bsm := NewBSQWithIv(d, S, X, T, r, q, 0, 0.0001, 3, 0.01, iv)
+		euro := bsm.GetOptionPriceFromIv(iv)
+		for _, kind := range []string{LatticeBinomial, LatticeTrinomial} {
+			l := NewLatticeWithIv(kind, d, false, 500, S, X, T, r, q, 0, 0.0001, 3, 0.01, iv)
+			if math.Abs(l.Price-euro) > 0.01 {
+				t.Errorf("%s %s european price %f != bsm %f", kind, d, l.Price, euro)
+			}
+			if math.Abs(l.Delta-bsm.Delta) > 1e-3 || math.Abs(l.Gamma-bsm.Gamma) > 1e-3 ||
+				math.Abs(l.Vega-bsm.Vega) > 1e-3 || math.Abs(l.Theta-bsm.Theta) > 1e-3 || math.Abs(l.Rho-bsm.Rho) > 1e-2 {
+				t.Errorf("%s %s greeks mismatch, lattice: %+v, bsm: %+v", kind, d, l, bsm)
+			}
+
+			american := NewLatticeWithIv(kind, d, true, 500, S, X, T, r, q, 0, 0.0001, 3, 0.01, iv)
+			if american.Price < l.Price-1e-10 {
+				t.Errorf("%s %s american price %f < european %f", kind, d, american.Price, l.Price)
+			}
+
+			l = NewLattice(kind, d, true, 500, S, X, T, r, q, american.Price, 1e-6, 3, 0.01)
+			if math.Abs(l.Iv-iv) > 1e-3 {
+				t.Errorf("%s %s american iv %f != %f", kind, d, l.Iv, iv)
+			}
+		}
+	}
+
+	// 无分红美式看涨不会提前行权
+	euro := NewLatticeWithIv(LatticeBinomial, "c", false, 200, S, X, T, r, 0, 0, 0.0001, 3, 0.01, iv)
+	american := NewLatticeWithIv(LatticeBinomial, "c", true, 200, S, X, T, r, 0, 0, 0.0001, 3, 0.01, iv)
+	if math.Abs(euro.Price-american.Price) > 1e-10 {
+		t.Errorf("american call without dividend %f != european %f", american.Price, euro.Price)
+	}
+
+	// 波动率低于1%时vega仍为有限值
+	small := NewLatticeWithIv(LatticeBinomial, "c", false, 500, S, 100, T, r, q, 0, 0.0001, 3, 0.001, 0.005)
+	bsm := NewBSQWithIv("c", S, 100, T, r, q, 0, 0.0001, 3, 0.001, 0.005)
+	if math.IsNaN(small.Vega) || math.IsInf(small.Vega, 0) || math.Abs(small.Vega-bsm.Vega) > 0.05 {
+		t.Errorf("small iv vega %v, bsm %v", small.Vega, bsm.Vega)
+	}
+	// 无法求解隐含波动率时不计算价格
+	if failed := NewLattice(LatticeBinomial, "c", false, 100, S, X, T, r, q, 0, 0.0001, 3, 0.01); failed.Iv != 0 || failed.Price != 0 || failed.Vega != 0 {
+		t.Errorf("failed lattice: %+v", failed)
+	}
+}
+
+func TestCbnd(t *testing.T) {
+	for _, rho := range []float64{-0.99, -0.95, -0.5, -0.1, 0, 0.1, 0.5, 0.95, 0.99} {
+		want := 0.25 + math.Asin(rho)/(2*math.Pi)
+		if got := Cbnd(0, 0, rho); math.Abs(got-want) > 1e-12 {
+			t.Errorf("Cbnd(0, 0, %v) = %v, want %v", rho, got, want)
+		}
+	}
+	if got := Cbnd(0.5, -1, 0); math.Abs(got-Cdf(0.5)*Cdf(-1)) > 1e-14 {
+		t.Errorf("Cbnd with rho 0 = %v, want %v", got, Cdf(0.5)*Cdf(-1))
+	}
+}
+
+func TestNewAmerican(t *testing.T) {
+	cases := [][6]float64{
+		// S, X, T, r, q, iv
+		{100, 100, 0.5, 0.08, 0.12, 0.2},
+		{90, 100, 0.25, 0.1, 0.0, 0.3},
+		{110, 100, 1, 0.05, 0.03, 0.25},
+		{40579, 39680, 30.0 / 365, 0.03, 0.05, 0.56},
+	}
+	for _, c := range cases {
+		S, X, T, r, q, iv := c[0], c[1], c[2], c[3], c[4], c[5]
+		for _, d := range []string{"c", "p"} {
+			tree := NewLatticeWithIv(LatticeBinomial, d, true, 800, S, X, T, r, q, 0, 0.0001, 3, 0.01, iv).Price
+			for _, method := range []string{AmericanBAW, AmericanBS2002} {
+				a := NewAmericanWithIv(method, d, S, X, T, r, q, 0, 0.0001, 3, 0.01, iv)
+				t.Logf("%s %s %v price %f, tree %f", method, d, c, a.Price, tree)
+				if math.Abs(a.Price-tree) > 0.01*tree+1e-3*X {
+					t.Errorf("%s %s %v price %f, tree %f", method, d, c, a.Price, tree)
+				}
+
+				a = NewAmerican(method, d, S, X, T, r, q, a.Price, 1e-6*X, 3, 0.01)
+				if math.Abs(a.Iv-iv) > 1e-3 {
+					t.Errorf("%s %s %v iv %f != %f", method, d, c, a.Iv, iv)
+				}
+			}
+		}
+	}
+}
+
+func TestBSM_ImVolWithSolver(t *testing.T) {
+	cases := [][6]float64{
+		// S, X, T, r, q, iv
+		{4600, 5000, 0.1644, 0.025, 0, 1.0304},
+		{100, 100, 0.5, 0.05, 0.02, 0.2},
+		{100, 125, 7.0 / 365, 0.01, 0, 0.4}, // 深度虚值短期
+		{100, 80, 7.0 / 365, 0.0, 0, 0.8},   // 深度实值
+		{25490.88, 25000, 0.03, 0, 0, 0.12}, // 低波动率
+	}
+	for _, c := range cases {
+		S, X, T, r, q, iv := c[0], c[1], c[2], c[3], c[4], c[5]
+		for _, d := range []string{"c", "p"} {
+			op := NewBSQWithIv(d, S, X, T, r, q, 0, 0.0001, 3, 0.01, iv).GetOptionPriceFromIv(iv)
+			for name, solver := range map[string]IvSolver{"newton": NewtonSolver{}, "rational": RationalSolver{}} {
+				bsm := NewBSQWithIv(d, S, X, T, r, q, op, 0.0001, 3, 0.01, 1)
+				res, err := bsm.ImVolWithSolver(solver)
+				if err != nil {
+					t.Errorf("%s %s %v err: %s", name, d, c, err)
+					continue
+				}
+				if math.Abs(bsm.Iv-iv) > 1e-8 {
+					t.Errorf("%s %s %v iv %.12f != %v, result: %+v", name, d, c, bsm.Iv, iv, res)
+				}
+			}
+		}
+	}
+
+	// 标准化价格的迭代次数
+	x, beta, _ := normalizedOtmCall(NewBSWithIv("c", 100, 120, 0.25, 0, 0, 0.0001, 3, 0.01, 0.3), 0.5)
+	s, n, converged := rationalImVol(x, beta, 8)
+	t.Logf("rational s: %v, iterations: %d, converged: %v", s, n, converged)
+
+	// 迭代恰好落在解上时不应被区间保护推开
+	bsm := BSM{D: "c", S: 1, X: math.Exp(0.17320508075688773), T: 0.2465753424657534, Op: 0.05365763551925329}
+	if res, err := bsm.ImVolWithSolver(RationalSolver{}); err != nil || math.Abs(res.Residual) > 1e-15 {
+		t.Errorf("rational exact landing: %+v, err: %v", res, err)
+	}
+}
+
+func TestRationalSolver(t *testing.T) {
+	cases := []struct {
+		d                 string
+		S, X, T, r, q, iv float64
+	}{
+		// |x| << 1 与短期限
+		{"c", 100, 100.1, 7.0 / 365, 0, 0, 0.2},
+		{"p", 100, 99.9, 7.0 / 365, 0, 0, 0.2},
+		{"c", 100, 100.1, 1.0 / 365 / 24, 0, 0, 0.2},
+		{"p", 100, 99.9, 1.0 / 365 / 24, 0, 0, 0.2},
+		{"c", 100, 100.1, 1.0 / 365, 0, 0, 0.2},
+		{"p", 100, 99.9, 1.0 / 365, 0, 0, 0.2},
+		{"c", 100, 100.1, 0.25, 0, 0, 0.2},
+		{"p", 100, 100.0001, 1, 0, 0, 0.2},
+		// 极小的虚值价格
+		{"c", 100, 105, 0.25, 0, 0, 0.01},
+		{"c", 100, 200, 0.1, 0, 0, 0.3},
+		{"c", 100, 130, 0.01, 0, 0, 0.2},
+		// 价格接近上界
+		{"c", 100, 100, 10, 0, 0, 3},
+		{"p", 100, 300, 1, 0, 0, 0.5},
+		// 实值
+		{"c", 100, 90, 0.25, 0.03, 0, 0.3},
+		{"p", 100, 110, 0.5, 0.01, 0.02, 0.25},
+		{"c", 100, 80, 1, 0.05, 0, 0.4},
+	}
+	for _, c := range cases {
+		op := NewBSQWithIv(c.d, c.S, c.X, c.T, c.r, c.q, 0, 0.0001, 3, 0.01, c.iv).GetOptionPriceFromIv(c.iv)
+		bsm := BSM{D: c.d, S: c.S, X: c.X, T: c.T, R: c.r, Q: c.q, Op: op}
+		res, err := RationalSolver{}.ImVol(&bsm)
+		if err != nil {
+			t.Errorf("%+v err: %s", c, err)
+			continue
+		}
+		if math.Abs(res.Iv/c.iv-1) > 1e-10 || res.Iterations > 3 {
+			t.Errorf("%+v: %+v", c, res)
+		}
+	}
+
+	// 深度实值时时间价值被报价的舍入误差淹没
+	for _, c := range [][4]float64{{50, 5, 0.03, 0.05}, {50, 0.25, 0, 0.2}} {
+		X, T, r, iv := c[0], c[1], c[2], c[3]
+		op := NewBSWithIv("c", 100, X, T, r, 0, 0.0001, 3, 0.01, iv).GetOptionPriceFromIv(iv)
+		bsm := BSM{D: "c", S: 100, X: X, T: T, R: r, Op: op}
+		if res, err := (RationalSolver{}).ImVol(&bsm); !errors.Is(err, ErrBelowIntrinsic) {
+			t.Errorf("deep itm %v: %+v, err %v", c, res, err)
+		}
+	}
+}
+
+func TestBSM_ImVolWithSolverError(t *testing.T) {
+	cases := []struct {
+		d   string
+		op  float64
+		err error
+	}{
+		{"c", 9.9, ErrBelowIntrinsic},    // 内在价值 10
+		{"c", 0, ErrBelowIntrinsic},      // 报价为0
+		{"c", 100.5, ErrAboveUpperBound}, // 上界 S
+		{"p", 0.0, ErrBelowIntrinsic},    // 虚值看跌报价为0
+		{"p", 90.5, ErrAboveUpperBound},  // 上界 X
+		{"c", 30, ErrIvOutOfRange},       // 需要的波动率高于IvMax
+	}
+	for _, c := range cases {
+		for name, solver := range map[string]IvSolver{"bisection": BisectionSolver{}, "newton": NewtonSolver{}, "rational": RationalSolver{}} {
+			bsm := NewBSWithIv(c.d, 100, 90, 0.1, 0, c.op, 0.0001, 0.5, 0.01, 0.3)
+			_, err := bsm.ImVolWithSolver(solver)
+			if c.err == ErrIvOutOfRange && name == "rational" {
+				// 有理求解器不受IvMax限制
+				if err != nil {
+					t.Errorf("%s %+v unexpected err: %s", name, c, err)
+				}
+				continue
+			}
+			if !errors.Is(err, c.err) {
+				t.Errorf("%s %+v err: %v, want %v", name, c, err, c.err)
+			}
+			if bsm.Iv != 0.3 {
+				t.Errorf("%s %+v bsm.Iv modified to %v", name, c, bsm.Iv)
+			}
+			var ivErr *IvError
+			if errors.As(err, &ivErr) {
+				t.Logf("%s: %s", name, ivErr)
+			}
+		}
+	}
+
+	bsm := NewBSWithIv("c", 100, 90, 0.1, 0, 12, 1e-12, 3, 0.01, 0.3)
+	_, err := bsm.ImVolWithSolver(NewtonSolver{MaxExecTimes: 1})
+	if !errors.Is(err, ErrNotConverged) {
+		t.Errorf("newton with 1 iteration err: %v, want %v", err, ErrNotConverged)
+	}
+}
+
+func TestBSM_ImVolBisection(t *testing.T) {
+	// 求解成功时更新Iv, 并按新的Iv重新计算希腊值
+	want := NewBSWithIv("c", 100, 105, 0.25, 0.03, 0, 0.0001, 3, 0.01, 0.25)
+	op := want.GetOptionPriceFromIv(0.25)
+	bsm := NewBSWithIv("c", 100, 105, 0.25, 0.03, op, 1e-10, 3, 0.01, 0.4)
+	if _, err := bsm.ImVolWithSolver(RationalSolver{}); err != nil {
+		t.Fatalf("rational err: %s", err)
+	}
+	if math.Abs(bsm.Iv-0.25) > 1e-8 || math.Abs(bsm.D1-want.D1) > 1e-8 || math.Abs(bsm.Delta-want.Delta) > 1e-8 || math.Abs(bsm.Vega-want.Vega) > 1e-8 {
+		t.Errorf("iv %v, d1 %v, delta %v, vega %v, want %v %v %v", bsm.Iv, bsm.D1, bsm.Delta, bsm.Vega, want.D1, want.Delta, want.Vega)
+	}
+	bsm = NewBS("c", 100, 105, 0.25, 0.03, op, 1e-10, 3, 0.01)
+	if math.Abs(bsm.Iv-0.25) > 1e-6 || math.Abs(bsm.Delta-want.Delta) > 1e-6 {
+		t.Errorf("init iv %v, delta %v, want delta %v", bsm.Iv, bsm.Delta, want.Delta)
+	}
+
+	// 报价高于内在价值但低于price(IvMin)时为ErrIvOutOfRange, 低于内在价值时为ErrBelowIntrinsic, 失败时不修改Iv
+	cases := []struct {
+		d   string
+		op  float64
+		err error
+	}{
+		{"c", 0.00005, ErrIvOutOfRange},
+		{"c", 9.9, ErrBelowIntrinsic},
+		{"c", 30, ErrIvOutOfRange},
+	}
+	for _, c := range cases {
+		bsm := NewBSWithIv(c.d, 100, 110, 0.1, 0, c.op, 0.0001, 0.5, 0.01, 0.3)
+		if c.err == ErrBelowIntrinsic {
+			bsm.X = 90
+		}
+		if _, err := bsm.ImVolBisection(); !errors.Is(err, c.err) || bsm.Iv != 0.3 {
+			t.Errorf("%+v: err %v, want %v, iv %v", c, err, c.err, bsm.Iv)
+		}
+	}
+	// 求解失败时Iv为0, 不计算希腊值和价格
+	if bsm := NewBS("c", 100, 110, 0.1, 0, 30, 0.0001, 0.5, 0.01); bsm.Iv != 0 || bsm.D1 != 0 || bsm.Delta != 0 || bsm.Gamma != 0 || bsm.Vega != 0 {
+		t.Errorf("init iv out of range: %+v", bsm)
+	}
+	if b76 := NewB76("c", 100, 110, 0.1, 0, 30, 0.0001, 0.5, 0.01); b76.Iv != 0 || b76.Delta != 0 || b76.Gamma != 0 || b76.Vega != 0 {
+		t.Errorf("b76 init iv out of range: %+v", b76)
+	}
+	if a := NewAmerican(AmericanBAW, "c", 100, 110, 0.1, 0, 0, 30, 0.0001, 0.5, 0.01); a.Iv != 0 || a.Price != 0 {
+		t.Errorf("american init iv out of range: %+v", a)
+	}
+	b76 := NewB76WithIv("c", 100, 110, 0.1, 0, 30, 0.0001, 0.5, 0.01, 0.3)
+	if _, err := b76.ImVolBisection(); !errors.Is(err, ErrIvOutOfRange) || b76.Iv != 0.3 {
+		t.Errorf("b76 err %v, iv %v", err, b76.Iv)
+	}
+}
+
+func BenchmarkRationalSolver(b *testing.B) {
+	bsm := NewBSWithIv("p", 4600, 5000, 0.1644, 0.025, 996.27, 0.01, 3, 0.3, 1.0304)
+	solver := RationalSolver{}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		solver.ImVol(bsm)
+	}
+}
+
+func TestBSM_HigherOrderGreeks(t *testing.T) {
+	S, X, T, r, q, iv := 100.0, 95.0, 0.4, 0.05, 0.02, 0.3
+	bs := func(d string, S, T, iv float64) *BSM {
+		return NewBSQWithIv(d, S, X, T, r, q, 0, 0.0001, 3, 0.01, iv)
+	}
+	for _, d := range []string{"c", "p"} {
+		bsm := bs(d, S, T, iv)
+		h := 1e-4
+		sUp, sDown := bs(d, S+h, T, iv), bs(d, S-h, T, iv)
+		ivUp, ivDown := bs(d, S, T, iv+h), bs(d, S, T, iv-h)
+		tUp, tDown := bs(d, S, T+h, iv), bs(d, S, T-h, iv)
+		for name, v := range map[string][2]float64{
+			"vanna":  {bsm.Vanna, (ivUp.Delta - ivDown.Delta) / (2 * h) / 100},
+			"volga":  {bsm.Volga, (ivUp.Vega - ivDown.Vega) / (2 * h) / 100},
+			"charm":  {bsm.Charm, -(tUp.Delta - tDown.Delta) / (2 * h) / 365},
+			"veta":   {bsm.Veta, -(tUp.Vega - tDown.Vega) / (2 * h) / 365},
+			"speed":  {bsm.Speed, (sUp.Gamma - sDown.Gamma) / (2 * h)},
+			"zomma":  {bsm.Zomma, (ivUp.Gamma - ivDown.Gamma) / (2 * h) / 100},
+			"color":  {bsm.Color, -(tUp.Gamma - tDown.Gamma) / (2 * h) / 365},
+			"ultima": {bsm.Ultima, (ivUp.Volga - ivDown.Volga) / (2 * h) / 100},
+		} {
+			if math.Abs(v[0]-v[1]) > 1e-7*math.Max(1, math.Abs(v[1])) {
+				t.Errorf("%s %s: analytic %v, numeric %v", d, name, v[0], v[1])
+			}
+		}
+	}
+}
+
+func TestNewBSWithConventions(t *testing.T) {
+	S, X, T, r, iv := 4600.0, 5000.0, 0.1644, 0.025, 1.0304
+	def := NewBSWithIv("p", S, X, T, r, 0, 0.01, 3, 0.3, iv)
+	conv := &Conventions{DayBasis: 252, VegaScale: 1, RhoScale: 10000, CashGreeks: true}
+	bsm := NewBSWithIv("p", S, X, T, r, 0, 0.01, 3, 0.3, iv, conv)
+
+	for name, v := range map[string][2]float64{
+		"theta":  {bsm.Theta, def.Theta * 365 / 252},
+		"vega":   {bsm.Vega, def.Vega * 100},
+		"rho":    {bsm.Rho, def.Rho / 100},
+		"volga":  {bsm.Volga, def.Volga * 10000},
+		"veta":   {bsm.Veta, def.Veta * 100 * 365 / 252},
+		"cash_d": {bsm.CashDelta, def.Delta * S},
+		"cash_g": {bsm.CashGamma, def.Gamma * S * S / 100},
+	} {
+		if math.Abs(v[0]-v[1]) > 1e-9*math.Max(1, math.Abs(v[1])) {
+			t.Errorf("%s: %v != %v", name, v[0], v[1])
+		}
+	}
+	if def.CashDelta != 0 || def.CashGamma != 0 {
+		t.Errorf("cash greeks should be disabled by default")
+	}
+	// 未设置的字段使用默认值
+	bsm = NewBSWithIv("p", S, X, T, r, 0, 0.01, 3, 0.3, iv, &Conventions{DayBasis: 252})
+	if bsm.Vega != def.Vega || bsm.Rho != def.Rho {
+		t.Errorf("zero conventions fields should use defaults")
+	}
+}
+
+func TestDigital(t *testing.T) {
+	S, X, T, r, q, iv := 100.0, 105.0, 0.5, 0.04, 0.01, 0.25
+	for _, d := range []string{"c", "p"} {
+		news := map[string]func(S, T, r, iv float64) *Digital{
+			DigitalCashOrNothing: func(S, T, r, iv float64) *Digital {
+				return NewCashOrNothing(d, S, X, 10, T, r, q, iv)
+			},
+			DigitalAssetOrNothing: func(S, T, r, iv float64) *Digital {
+				return NewAssetOrNothing(d, S, X, T, r, q, iv)
+			},
+			DigitalGap: func(S, T, r, iv float64) *Digital {
+				return NewGap(d, S, X, 100, T, r, q, iv)
+			},
+		}
+		for kind, newDg := range news {
+			dg := newDg(S, T, r, iv)
+			h := 1e-4
+			price := func(dg *Digital) float64 { return dg.Price }
+			for name, v := range map[string][2]float64{
+				"delta": {dg.Delta, (price(newDg(S+h, T, r, iv)) - price(newDg(S-h, T, r, iv))) / (2 * h)},
+				"gamma": {dg.Gamma, (newDg(S+h, T, r, iv).Delta - newDg(S-h, T, r, iv).Delta) / (2 * h)},
+				"vega":  {dg.Vega, (price(newDg(S, T, r, iv+h)) - price(newDg(S, T, r, iv-h))) / (2 * h) / 100},
+				"theta": {dg.Theta, -(price(newDg(S, T+h, r, iv)) - price(newDg(S, T-h, r, iv))) / (2 * h) / 365},
+				"rho":   {dg.Rho, (price(newDg(S, T, r+h, iv)) - price(newDg(S, T, r-h, iv))) / (2 * h) / 100},
+			} {
+				if math.Abs(v[0]-v[1]) > 1e-6*math.Max(1, math.Abs(v[1])) {
+					t.Errorf("%s %s %s: analytic %v, numeric %v", kind, d, name, v[0], v[1])
+				}
+			}
+		}
+
+		// 资产或无 - X*单位现金或无 = 普通期权 = X2取X的缺口期权
+		vanilla := NewBSQWithIv(d, S, X, T, r, q, 0, 0.0001, 3, 0.01, iv).GetOptionPriceFromIv(iv)
+		replicate := NewAssetOrNothing(d, S, X, T, r, q, iv).Price - NewCashOrNothing(d, S, X, X, T, r, q, iv).Price
+		if d == "p" {
+			replicate = -replicate
+		}
+		if gap := NewGap(d, S, X, X, T, r, q, iv).Price; math.Abs(vanilla-replicate) > 1e-10 || math.Abs(vanilla-gap) > 1e-10 {
+			t.Errorf("%s vanilla %v, replicate %v, gap %v", d, vanilla, replicate, gap)
+		}
+	}
+
+	// 实值现金或无看涨价格随波动率递减, 隐含波动率唯一
+	dg := NewCashOrNothing("c", 110, 100, 1, T, r, q, iv)
+	res, err := dg.ImVol(dg.Price, 1e-12, 3, 0.01)
+	if err != nil || math.Abs(res.Iv-iv) > 1e-6 {
+		t.Errorf("cash-or-nothing iv: %+v, err: %v", res, err)
+	}
+	dg = NewAssetOrNothing("p", 90, 100, T, r, q, iv)
+	res, err = dg.ImVol(dg.Price, 1e-12, 3, 0.01)
+	if err != nil || math.Abs(res.Iv-iv) > 1e-6 {
+		t.Errorf("asset-or-nothing iv: %+v, err: %v", res, err)
+	}
+	// 虚值现金或无看涨价格随波动率先增后减
+	dg = NewCashOrNothing("c", 90, 100, 1, T, r, q, iv)
+	if _, err = dg.ImVol(dg.Price, 1e-12, 3, 0.01); !errors.Is(err, ErrNonMonotonic) {
+		t.Errorf("otm cash-or-nothing err: %v, want %v", err, ErrNonMonotonic)
+	}
+}
+
+func TestBarrier(t *testing.T) {
+	S, T, r, q, iv := 100.0, 0.5, 0.08, 0.04, 0.25
+	// Haug Table 4-13, rebate = 3
+	for _, c := range []struct {
+		typ, d string
+		X, H   float64
+		want   float64
+	}{
+		{BarrierDownOut, "c", 90, 95, 9.0246},
+		{BarrierDownIn, "c", 90, 95, 7.7627},
+		{BarrierUpOut, "c", 90, 105, 2.6789},
+		{BarrierUpIn, "c", 90, 105, 14.1112},
+		{BarrierDownOut, "p", 90, 95, 2.2798},
+		{BarrierDownIn, "p", 90, 95, 2.9586},
+		{BarrierUpOut, "p", 90, 105, 3.7760},
+		{BarrierUpIn, "p", 90, 105, 1.4653},
+	} {
+		if b := NewBarrier(c.typ, c.d, S, c.X, c.H, 3, T, r, q, iv, 0); math.Abs(b.Price-c.want) > 1e-4 {
+			t.Errorf("%s %s X=%v H=%v: got %v, want %v", c.typ, c.d, c.X, c.H, b.Price, c.want)
+		}
+	}
+
+	// 无补偿金时 敲入 + 敲出 = 普通期权
+	for _, d := range []string{"c", "p"} {
+		for _, X := range []float64{90, 100, 110} {
+			vanilla := NewBSQWithIv(d, S, X, T, r, q, 0, 0.0001, 3, 0.01, iv)
+			for _, c := range []struct {
+				in, out string
+				H       float64
+			}{{BarrierDownIn, BarrierDownOut, 95}, {BarrierUpIn, BarrierUpOut, 105}} {
+				in := NewBarrier(c.in, d, S, X, c.H, 0, T, r, q, iv, 1.0/365)
+				out := NewBarrier(c.out, d, S, X, c.H, 0, T, r, q, iv, 1.0/365)
+				if math.Abs(in.Price+out.Price-vanilla.GetOptionPriceFromIv(iv)) > 1e-10 {
+					t.Errorf("%s X=%v %s+%s price: %v + %v", d, X, c.in, c.out, in.Price, out.Price)
+				}
+				if math.Abs(in.Delta+out.Delta-vanilla.Delta) > 1e-6 {
+					t.Errorf("%s X=%v %s+%s delta: %v + %v", d, X, c.in, c.out, in.Delta, out.Delta)
+				}
+			}
+		}
+	}
+
+	// 离散观察的敲出期权价值介于连续观察与普通期权之间
+	cont := NewBarrier(BarrierDownOut, "c", S, 100, 95, 0, T, r, q, iv, 0)
+	daily := NewBarrier(BarrierDownOut, "c", S, 100, 95, 0, T, r, q, iv, 1.0/365)
+	vanilla := NewBSQWithIv("c", S, 100, T, r, q, 0, 0.0001, 3, 0.01, iv).GetOptionPriceFromIv(iv)
+	if !(cont.Price < daily.Price && daily.Price < vanilla) {
+		t.Errorf("continuous %v, daily %v, vanilla %v", cont.Price, daily.Price, vanilla)
+	}
+
+	// 已触及障碍: 敲入为普通期权, 敲出为补偿金
+	if b := NewBarrier(BarrierDownIn, "c", 94, 100, 95, 3, T, r, q, iv, 0); math.Abs(b.Price-NewBSQWithIv("c", 94, 100, T, r, q, 0, 0.0001, 3, 0.01, iv).GetOptionPriceFromIv(iv)) > 1e-10 {
+		t.Errorf("knocked-in price %v", b.Price)
+	}
+	if b := NewBarrier(BarrierUpOut, "p", 106, 100, 105, 3, T, r, q, iv, 0); b.Price != 3 || b.Delta != 0 {
+		t.Errorf("knocked-out price %v, delta %v", b.Price, b.Delta)
+	}
+}
+
+func TestAsian(t *testing.T) {
+	// Haug 4.20.1 几何平均: S=80, X=85, T=0.25, r=0.05, b=0.08, iv=0.2, put = 4.6922
+	if a := NewAsian(AsianGeometric, "p", 80, 0, 85, 0.25, 0, 0.05, -0.03, 0.2); math.Abs(a.Price-4.6922) > 1e-4 {
+		t.Errorf("geometric put: got %v, want 4.6922", a.Price)
+	}
+
+	S, X, r, q, iv := 100.0, 100.0, 0.05, 0.02, 0.6
+	for _, c := range []struct {
+		SA, T, T0 float64
+	}{
+		{0, 0.5, 0},        // 窗口从当前开始
+		{0, 0.5, 0.25},     // 窗口未开始
+		{98, 0.02, -0.02},  // 窗口已过半
+		{103, 0.01, -0.04}, // 窗口已过80%
+	} {
+		call := NewAsian(AsianTurnbullWakeman, "c", S, c.SA, X, c.T, c.T0, r, q, iv)
+		put := NewAsian(AsianTurnbullWakeman, "p", S, c.SA, X, c.T, c.T0, r, q, iv)
+		geo := NewAsian(AsianGeometric, "c", S, c.SA, X, c.T, c.T0, r, q, iv)
+		if call.Price <= geo.Price {
+			t.Errorf("%+v: arithmetic call %v <= geometric call %v", c, call.Price, geo.Price)
+		}
+		// 算术平均的平价关系: C - P = e^{-rT} * (E[A] - X)
+		tau := math.Max(c.T0, 0)
+		mean := ((tau-c.T0)*c.SA + (c.T-tau)*S*asianM1(c.T, tau, r-q)) / (c.T - c.T0)
+		if parity := math.Exp(-r*c.T) * (mean - X); math.Abs(call.Price-put.Price-parity) > 1e-10 {
+			t.Errorf("%+v: call - put = %v, want %v", c, call.Price-put.Price, parity)
+		}
+		if call.Delta <= 0 || call.Delta >= 1 || put.Delta >= 0 || call.Vega <= 0 {
+			t.Errorf("%+v: call %+v, put %+v", c, call, put)
+		}
+	}
+
+	// 已实现部分足以保证实值, 看涨期权价值确定, 看跌为0
+	call := NewAsian(AsianTurnbullWakeman, "c", S, 200, X, 0.01, -0.04, r, q, iv)
+	put := NewAsian(AsianTurnbullWakeman, "p", S, 200, X, 0.01, -0.04, r, q, iv)
+	if want := math.Exp(-r*0.01) * ((0.04*200+0.01*S*asianM1(0.01, 0, r-q))/0.05 - X); math.Abs(call.Price-want) > 1e-10 || put.Price != 0 {
+		t.Errorf("deep itm: call %v, want %v, put %v", call.Price, want, put.Price)
+	}
+}
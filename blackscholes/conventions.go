@@ -0,0 +1,36 @@
+package blackscholes
+
+// 希腊值口径, 用于与各交易所报表对齐
+type Conventions struct {
+	DayBasis   float64 `json:"day_basis"`   // 一年的天数, theta, charm等时间类希腊值按每天计算, 默认365, 按交易日可设为252
+	VegaScale  float64 `json:"vega_scale"`  // 波动率类希腊值的缩放, 默认100即每1%波动率, 1为每单位波动率
+	RhoScale   float64 `json:"rho_scale"`   // rho, phi的缩放, 默认100即每1%利率
+	CashGreeks bool    `json:"cash_greeks"` // 是否计算现金希腊值 CashDelta, CashGamma
+}
+
+func DefaultConventions() *Conventions {
+	return &Conventions{
+		DayBasis:  365,
+		VegaScale: 100,
+		RhoScale:  100,
+	}
+}
+
+// 未设置(<=0)的字段使用默认值
+func (c *Conventions) withDefaults() *Conventions {
+	d := DefaultConventions()
+	if c == nil {
+		return d
+	}
+	if c.DayBasis > 0 {
+		d.DayBasis = c.DayBasis
+	}
+	if c.VegaScale > 0 {
+		d.VegaScale = c.VegaScale
+	}
+	if c.RhoScale > 0 {
+		d.RhoScale = c.RhoScale
+	}
+	d.CashGreeks = c.CashGreeks
+	return d
+}
@@ -0,0 +1,188 @@
+package blackscholes
+
+import (
+	"math"
+	"strings"
+)
+
+const (
+	DigitalCashOrNothing  = "cash"  // 现金或无: 到期实值时支付固定金额K
+	DigitalAssetOrNothing = "asset" // 资产或无: 到期实值时支付标的
+	DigitalGap            = "gap"   // 缺口期权: 以X为触发价格, 到期实值时按X2行权
+)
+
+// 数字(二元)期权及缺口期权定价
+// see: Haug, The Complete Guide to Option Pricing Formulas, chapter 4.19
+type Digital struct {
+	Kind  string  `json:"kind"`          // 期权类型 cash / asset / gap
+	D     string  `json:"direction"`     // direction 期权方向 看涨：c 看跌：p
+	S     float64 `json:"subject_price"` // subjectPrice期权标的价格（指数价格）
+	X     float64 `json:"strike_price"`  // 行权价格, 缺口期权为触发价格
+	X2    float64 `json:"payoff_strike"` // 缺口期权的支付行权价格
+	K     float64 `json:"cash_amount"`   // 现金或无期权的支付金额
+	T     float64 `json:"rest_time"`     // （期权到期日-当前时间）/365天
+	R     float64 `json:"price_rate"`    // 计价币种的利率
+	Q     float64 `json:"dividend_rate"` // 标的连续分红率/外币利率
+	Iv    float64 `json:"volatility"`    // 年化波动率
+	D1    float64 `json:"d1"`            // 中间值d1
+	D2    float64 `json:"d2"`            // 中间值d2
+	Price float64 `json:"price"`         // 期权价格
+	Delta float64 `json:"delta"`         // 希腊值delta
+	Gamma float64 `json:"gamma"`         // 希腊值gamma
+	Vega  float64 `json:"vega"`          // 希腊值vega
+	Theta float64 `json:"theta"`         // 希腊值theta
+	Rho   float64 `json:"rho"`           // 希腊值rho
+
+	Conventions *Conventions `json:"conventions"` // 希腊值口径, 为nil时使用DefaultConventions
+}
+
+func NewCashOrNothing(direction string, S float64, X float64, K float64, T float64, r float64, q float64, iv float64, conventions ...*Conventions) *Digital {
+	return newDigital(DigitalCashOrNothing, direction, S, X, 0, K, T, r, q, iv, conventions)
+}
+
+func NewAssetOrNothing(direction string, S float64, X float64, T float64, r float64, q float64, iv float64, conventions ...*Conventions) *Digital {
+	return newDigital(DigitalAssetOrNothing, direction, S, X, 0, 0, T, r, q, iv, conventions)
+}
+
+func NewGap(direction string, S float64, X1 float64, X2 float64, T float64, r float64, q float64, iv float64, conventions ...*Conventions) *Digital {
+	return newDigital(DigitalGap, direction, S, X1, X2, 0, T, r, q, iv, conventions)
+}
+
+func newDigital(kind string, direction string, S, X, X2, K, T, r, q, iv float64, conventions []*Conventions) *Digital {
+	dg := Digital{
+		Kind: kind,
+		D:    strings.ToLower(direction),
+		S:    S,
+		X:    X,
+		X2:   X2,
+		K:    K,
+		T:    T,
+		R:    r,
+		Q:    q,
+		Iv:   iv,
+	}
+	if len(conventions) > 0 {
+		dg.Conventions = conventions[0]
+	}
+	dg.Init()
+	return &dg
+}
+
+func (dg *Digital) Init() {
+	dg.Conventions = dg.Conventions.withDefaults()
+	dg.Price = dg.GetOptionPriceFromIv(dg.Iv)
+	dg.calcGreeks()
+}
+
+func (dg *Digital) phi() float64 {
+	if dg.D == "p" {
+		return -1
+	}
+	return 1
+}
+
+// 通过隐含波动率找到对应的期权报价
+func (dg *Digital) GetOptionPriceFromIv(iv float64) float64 {
+	dg.Iv = iv
+	v := iv * math.Sqrt(dg.T)
+	dg.D1 = (math.Log(dg.S/dg.X) + (dg.R-dg.Q+iv*iv/2)*dg.T) / v
+	dg.D2 = dg.D1 - v
+	phi := dg.phi()
+	cash := math.Exp(-dg.R*dg.T) * Cdf(phi*dg.D2)
+	asset := dg.S * math.Exp(-dg.Q*dg.T) * Cdf(phi*dg.D1)
+	switch dg.Kind {
+	case DigitalCashOrNothing:
+		return dg.K * cash
+	case DigitalAssetOrNothing:
+		return asset
+	case DigitalGap:
+		return phi * (asset - dg.X2*cash)
+	}
+	return 0
+}
+
+// 单位现金或无, 资产或无期权的希腊值, 缺口期权为两者的线性组合
+func (dg *Digital) calcGreeks() {
+	phi := dg.phi()
+	v := dg.Iv * math.Sqrt(dg.T)
+	dr, dq := math.Exp(-dg.R*dg.T), math.Exp(-dg.Q*dg.T)
+	nd1, nd2 := nd(dg.D1), nd(dg.D2)
+
+	cashPrice := dr * Cdf(phi*dg.D2)
+	cashDelta := phi * dr * nd2 / (dg.S * v)
+	cashGamma := -phi * dr * nd2 * dg.D1 / (dg.S * dg.S * v * v)
+	cashVega := -phi * dr * nd2 * dg.D1 / dg.Iv
+	cashTheta := dg.R*cashPrice - phi*dr*nd2*(2*(dg.R-dg.Q)*dg.T-dg.D1*v)/(2*dg.T*v)
+	cashRho := -dg.T*cashPrice + phi*dr*nd2*dg.T/v
+
+	assetPrice := dg.S * dq * Cdf(phi*dg.D1)
+	assetDelta := dq*Cdf(phi*dg.D1) + phi*dq*nd1/v
+	assetGamma := -phi * dq * nd1 * dg.D2 / (dg.S * v * v)
+	assetVega := -phi * dg.S * dq * nd1 * dg.D2 / dg.Iv
+	assetTheta := dg.Q*assetPrice - phi*dg.S*dq*nd1*(2*(dg.R-dg.Q)*dg.T-dg.D2*v)/(2*dg.T*v)
+	assetRho := phi * dg.S * dq * nd1 * dg.T / v
+
+	var wAsset, wCash float64
+	switch dg.Kind {
+	case DigitalCashOrNothing:
+		wAsset, wCash = 0, dg.K
+	case DigitalAssetOrNothing:
+		wAsset, wCash = 1, 0
+	case DigitalGap:
+		wAsset, wCash = phi, -phi*dg.X2
+	}
+	c := dg.Conventions
+	dg.Delta = wAsset*assetDelta + wCash*cashDelta
+	dg.Gamma = wAsset*assetGamma + wCash*cashGamma
+	dg.Vega = (wAsset*assetVega + wCash*cashVega) / c.VegaScale
+	dg.Theta = (wAsset*assetTheta + wCash*cashTheta) / c.DayBasis
+	dg.Rho = (wAsset*assetRho + wCash*cashRho) / c.RhoScale
+}
+
+// vega变号处的波动率, 不存在时返回0
+func (dg *Digital) criticalIv() float64 {
+	m := math.Log(dg.S/dg.X) + (dg.R-dg.Q)*dg.T
+	var v2 float64
+	switch dg.Kind {
+	case DigitalCashOrNothing:
+		// vega ∝ -d1
+		v2 = -2 * m
+	case DigitalAssetOrNothing:
+		// vega ∝ -d2
+		v2 = 2 * m
+	case DigitalGap:
+		// vega ∝ X2*d1 - X*d2
+		v2 = -2 * m * (dg.X2 - dg.X) / (dg.X2 + dg.X)
+	}
+	if v2 <= 0 {
+		return 0
+	}
+	return math.Sqrt(v2 / dg.T)
+}
+
+// 通过报价反推隐含波动率, 仅当价格在[ivMin, ivMax]内随波动率单调时有唯一解, 否则返回ErrNonMonotonic
+// 不修改dg
+func (dg *Digital) ImVol(op float64, opEpsilon float64, ivMax float64, ivMin float64) (*IvResult, error) {
+	if ivMin < 1e-4 {
+		ivMin = 1e-4
+	}
+	if iv := dg.criticalIv(); iv > ivMin && iv < ivMax {
+		return newIvError(ErrNonMonotonic, op, 0, IvResult{Iv: iv})
+	}
+
+	d := *dg
+	if d.GetOptionPriceFromIv(ivMax) >= d.GetOptionPriceFromIv(ivMin) {
+		return solveBisection(op, opEpsilon, ivMax, ivMin, d.GetOptionPriceFromIv)
+	}
+	// 价格随波动率递减, 令 iv = ivMax + ivMin - u 转换为递增
+	res, err := solveBisection(op, opEpsilon, ivMax, ivMin, func(u float64) float64 {
+		return d.GetOptionPriceFromIv(ivMax + ivMin - u)
+	})
+	if res.Iv != 0 {
+		res.Iv = ivMax + ivMin - res.Iv
+	}
+	if ivErr, ok := err.(*IvError); ok {
+		ivErr.Result = *res
+	}
+	return res, err
+}
@@ -0,0 +1,59 @@
+package blackscholes
+
+// 币本位(反向)期权, 权利金和到期收益均以标的币计价
+// 币本位价格 = U本位价格 / S, 隐含波动率与对应U本位期权相同
+type Inverse struct {
+	*BSM
+	OpCoin        float64 `json:"option_price_coin"` // 币本位期权报价
+	OpEpsilonCoin float64 `json:"op_epsilon_coin"`   // 币本位价格精度
+	DeltaCoin     float64 `json:"delta_coin"`        // 币本位delta, 已扣除权利金以币计价带来的delta: Delta - Op/S
+	GammaCoin     float64 `json:"gamma_coin"`        // 币本位gamma, DeltaCoin对underlying价格的敏感度
+	VegaCoin      float64 `json:"vega_coin"`         // 币本位vega
+	ThetaCoin     float64 `json:"theta_coin"`        // 币本位theta
+	RhoCoin       float64 `json:"rho_coin"`          // 币本位rho
+	PhiCoin       float64 `json:"phi_coin"`          // 币本位phi
+}
+
+func NewInverse(direction string, S float64, X float64, T float64, r float64, q float64, opCoin float64, opEpsilonCoin float64, ivMax float64, ivMin float64, conventions ...*Conventions) *Inverse {
+	inv := Inverse{
+		BSM:           NewBSQ(direction, S, X, T, r, q, opCoin*S, opEpsilonCoin*S, ivMax, ivMin, conventions...),
+		OpCoin:        opCoin,
+		OpEpsilonCoin: opEpsilonCoin,
+	}
+	inv.calcCoin()
+	return &inv
+}
+
+func NewInverseWithIv(direction string, S float64, X float64, T float64, r float64, q float64, opCoin float64, opEpsilonCoin float64, ivMax float64, ivMin float64, iv float64, conventions ...*Conventions) *Inverse {
+	inv := Inverse{
+		BSM:           NewBSQWithIv(direction, S, X, T, r, q, opCoin*S, opEpsilonCoin*S, ivMax, ivMin, iv, conventions...),
+		OpCoin:        opCoin,
+		OpEpsilonCoin: opEpsilonCoin,
+	}
+	inv.calcCoin()
+	return &inv
+}
+
+func (inv *Inverse) Init() {
+	inv.BSM.Op = inv.OpCoin * inv.S
+	inv.BSM.OpEpsilon = inv.OpEpsilonCoin * inv.S
+	inv.BSM.Init()
+	inv.calcCoin()
+}
+
+// 通过隐含波动率找到对应的币本位期权报价
+func (inv *Inverse) GetOptionPriceFromIv(iv float64) float64 {
+	return inv.BSM.GetOptionPriceFromIv(iv) / inv.S
+}
+
+// 把U本位希腊值换算为币本位
+func (inv *Inverse) calcCoin() {
+	iv := inv.Iv
+	opCoin := inv.GetOptionPriceFromIv(iv)
+	inv.DeltaCoin = inv.Delta - opCoin
+	inv.GammaCoin = inv.Gamma - inv.DeltaCoin/inv.S
+	inv.VegaCoin = inv.Vega / inv.S
+	inv.ThetaCoin = inv.Theta / inv.S
+	inv.RhoCoin = inv.Rho / inv.S
+	inv.PhiCoin = inv.Phi / inv.S
+}
@@ -0,0 +1,494 @@
+package blackscholes
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+var (
+	ErrBelowIntrinsic  = errors.New("option price below intrinsic value")               // 报价低于内在价值(无套利下界)
+	ErrAboveUpperBound = errors.New("option price above no-arbitrage upper bound")      // 报价高于无套利上界(看涨:标的远期现值, 看跌:行权价现值)
+	ErrIvOutOfRange    = errors.New("implied volatility out of [iv_min, iv_max]")       // 隐含波动率超出[IvMin, IvMax]
+	ErrNotConverged    = errors.New("implied volatility solver did not converge")       // 达到最大迭代次数仍未收敛
+	ErrInvalidOption   = errors.New("invalid option direction, must be \"c\" or \"p\"") // 期权方向错误
+	ErrNonMonotonic    = errors.New("option price is not monotonic in volatility")      // 价格随波动率不单调, 隐含波动率不唯一
+)
+
+// 隐含波动率求解结果
+type IvResult struct {
+	Iv         float64 `json:"volatility"` // 隐含波动率, 出错时为截断后的值
+	Iterations int     `json:"iterations"` // 迭代次数
+	Residual   float64 `json:"residual"`   // 最终价格残差: 模型价格 - 报价
+	Converged  bool    `json:"converged"`  // 是否收敛
+}
+
+// 隐含波动率求解错误, 可用 errors.Is 判断具体原因
+type IvError struct {
+	Err    error    // ErrBelowIntrinsic, ErrAboveUpperBound, ErrIvOutOfRange, ErrNotConverged, ErrInvalidOption
+	Op     float64  // 期权报价
+	Bound  float64  // 触发的价格边界
+	Result IvResult // 求解结果
+}
+
+func (e *IvError) Error() string {
+	return fmt.Sprintf("%s, op: %v, bound: %v, iv: %v, iterations: %d, residual: %v",
+		e.Err, e.Op, e.Bound, e.Result.Iv, e.Result.Iterations, e.Result.Residual)
+}
+
+func (e *IvError) Unwrap() error {
+	return e.Err
+}
+
+func newIvError(err error, op float64, bound float64, result IvResult) (*IvResult, error) {
+	return &result, &IvError{Err: err, Op: op, Bound: bound, Result: result}
+}
+
+// 隐含波动率求解器, 通过 BSM.ImVolWithSolver 按次选择
+// 求解器不修改传入的bsm
+type IvSolver interface {
+	ImVol(bsm *BSM) (*IvResult, error)
+}
+
+// 检查报价是否在BSM无套利区间[内在价值, 上界]内
+func checkBSMBounds(bsm *BSM) (*IvResult, error) {
+	theta := 1.0
+	if bsm.D == "p" {
+		theta = -1
+	} else if bsm.D != "c" {
+		return newIvError(ErrInvalidOption, bsm.Op, 0, IvResult{})
+	}
+	spot := bsm.S * math.Exp(-bsm.Q*bsm.T)
+	strike := bsm.X * math.Exp(-bsm.R*bsm.T)
+	intrinsic := math.Max(theta*(spot-strike), 0)
+	if bsm.Op <= intrinsic {
+		return newIvError(ErrBelowIntrinsic, bsm.Op, intrinsic, IvResult{Residual: intrinsic - bsm.Op})
+	}
+	upper := spot
+	if theta < 0 {
+		upper = strike
+	}
+	if bsm.Op >= upper {
+		return newIvError(ErrAboveUpperBound, bsm.Op, upper, IvResult{Residual: upper - bsm.Op})
+	}
+	return nil, nil
+}
+
+// 割线法+二分法, 即 BSM.ImVolBisection, 以OpEpsilon为价格精度
+type BisectionSolver struct{}
+
+func (BisectionSolver) ImVol(bsm *BSM) (*IvResult, error) {
+	if res, err := checkBSMBounds(bsm); err != nil {
+		return res, err
+	}
+	b := *bsm
+	return solveBisection(b.Op, b.OpEpsilon, b.IvMax, b.IvMin, b.GetOptionPriceFromIv)
+}
+
+// 带vega保护的牛顿法: vega过小或迭代跳出区间时退化为二分, 结果限制在[IvMin, IvMax]内
+type NewtonSolver struct {
+	MaxExecTimes int     // 最大迭代次数, 默认MaxExecTimes
+	Tolerance    float64 // 波动率精度, 默认1e-12
+	MinVega      float64 // vega(未除以100)低于该值时改用二分, 默认1e-8*S
+}
+
+func (ns NewtonSolver) ImVol(bsm *BSM) (*IvResult, error) {
+	if res, err := checkBSMBounds(bsm); err != nil {
+		return res, err
+	}
+	maxExecTimes, tolerance, minVega := ns.MaxExecTimes, ns.Tolerance, ns.MinVega
+	if maxExecTimes <= 0 {
+		maxExecTimes = MaxExecTimes
+	}
+	if tolerance <= 0 {
+		tolerance = 1e-12
+	}
+	if minVega <= 0 {
+		minVega = 1e-8 * bsm.S
+	}
+
+	b := *bsm
+	ivMax, ivMin := b.IvMax, b.IvMin
+	if ivMin < 1e-4 {
+		ivMin = 1e-4
+	}
+	if opMax := b.GetOptionPriceFromIv(ivMax); b.Op >= opMax {
+		return newIvError(ErrIvOutOfRange, b.Op, opMax, IvResult{Iv: ivMax, Residual: opMax - b.Op})
+	}
+	if opMin := b.GetOptionPriceFromIv(ivMin); b.Op <= opMin {
+		return newIvError(ErrIvOutOfRange, b.Op, opMin, IvResult{Iv: ivMin, Residual: opMin - b.Op})
+	}
+
+	iv := newtonInitialIv(&b)
+	if iv <= ivMin || iv >= ivMax {
+		iv = (ivMax + ivMin) / 2
+	}
+	result := IvResult{}
+	for result.Iterations < maxExecTimes {
+		result.Iterations++
+		diff := b.GetOptionPriceFromIv(iv) - b.Op
+		if diff == 0 {
+			result.Converged = true
+			break
+		}
+		// 维护包含解的区间
+		if diff > 0 {
+			ivMax = iv
+		} else {
+			ivMin = iv
+		}
+
+		vega := b.S * b.ExpQT * b.ExtractT * nd(b.D1)
+		next := iv - diff/vega
+		if vega < minVega || next <= ivMin || next >= ivMax {
+			next = (ivMax + ivMin) / 2
+		}
+		if math.Abs(next-iv) < tolerance {
+			iv = next
+			result.Converged = true
+			break
+		}
+		iv = next
+	}
+	result.Iv = iv
+	result.Residual = b.GetOptionPriceFromIv(iv) - b.Op
+	if !result.Converged {
+		return newIvError(ErrNotConverged, b.Op, 0, result)
+	}
+	return &result, nil
+}
+
+// Manaster-Koehler初值, 使d1=0附近vega最大
+func newtonInitialIv(bsm *BSM) float64 {
+	m := math.Abs(math.Log(bsm.S/bsm.X) + (bsm.R-bsm.Q)*bsm.T)
+	if m < 1e-8 {
+		// 平值附近用Brenner-Subrahmanyam近似
+		return math.Sqrt(2*math.Pi/bsm.T) * bsm.Op / (bsm.S * math.Exp(-bsm.Q*bsm.T))
+	}
+	return math.Sqrt(2 * m / bsm.T)
+}
+
+// Jäckel "Let's Be Rational" 风格求解器:
+// 转换为标准化的虚值Black价格, 以 sl < sc < su 把价格分为四个区域, 用各区域的有理三次插值作为初值,
+// 再对价格、价格的对数或到上界距离的对数做三阶Householder迭代, 通常1~3次迭代即可达到机器精度. 结果不受IvMin/IvMax限制
+// 深度实值期权的时间价值被报价的舍入误差淹没、无法确定波动率时返回 ErrBelowIntrinsic
+// see: http://www.jaeckel.org/LetsBeRational.pdf
+type RationalSolver struct {
+	MaxExecTimes int // 最大迭代次数, 默认8
+}
+
+const (
+	dblEpsilon          = 2.220446049250313e-16
+	rationalCubicMinR   = -(1 - 1.4901161193847656e-08) // 有理三次插值控制参数的下限 -(1-sqrt(eps))
+	rationalCubicMaxR   = 2 / (dblEpsilon * dblEpsilon) // 控制参数超过该值时退化为线性插值
+	rationalIvPrecision = 1e-8                          // 报价舍入误差引起的波动率相对误差上限
+)
+
+func (rs RationalSolver) ImVol(bsm *BSM) (*IvResult, error) {
+	if res, err := checkBSMBounds(bsm); err != nil {
+		return res, err
+	}
+	maxExecTimes := rs.MaxExecTimes
+	if maxExecTimes <= 0 {
+		maxExecTimes = 8
+	}
+	x, beta, scale := normalizedOtmCall(bsm, bsm.Op)
+	quote := bsm.Op / scale
+	if !(beta > 0) {
+		return newIvError(ErrBelowIntrinsic, bsm.Op, (quote-beta)*scale, IvResult{Residual: -beta * scale})
+	}
+	s, iterations, converged := rationalImVol(x, beta, maxExecTimes)
+
+	b := *bsm
+	result := IvResult{Iv: s / math.Sqrt(b.T), Iterations: iterations, Converged: converged}
+	result.Residual = b.GetOptionPriceFromIv(result.Iv) - b.Op
+	if !converged {
+		return newIvError(ErrNotConverged, b.Op, 0, result)
+	}
+	// 报价的舍入误差除以标准化vega即为波动率的误差, 实值期权扣除内在价值后误差被放大
+	_, vega, _, _ := normalizedBlack(x, s)
+	if 4*dblEpsilon*quote > rationalIvPrecision*s*vega {
+		result.Converged = false
+		return newIvError(ErrBelowIntrinsic, b.Op, (quote-beta)*scale, result)
+	}
+	return &result, nil
+}
+
+// 把BSM报价转换为标准化的虚值看涨价格 b(x) = e^(x/2)N(x/s+s/2) - e^(-x/2)N(x/s-s/2), x=ln(F/X)<=0
+// scale = sqrt(F*X)*e^(-rT) 为报价到标准化价格的缩放, 实值期权在标准化价格中扣除标准化内在价值 |e^(x/2)-e^(-x/2)|
+// 调用前需保证报价在无套利区间内
+func normalizedOtmCall(bsm *BSM, op float64) (x, beta, scale float64) {
+	theta := 1.0
+	if bsm.D == "p" {
+		theta = -1
+	}
+	F := bsm.S * math.Exp((bsm.R-bsm.Q)*bsm.T)
+	scale = math.Sqrt(F*bsm.X) * math.Exp(-bsm.R*bsm.T)
+	beta = op / scale
+
+	x = math.Log(F / bsm.X)
+	// 实值期权用平价公式转换为虚值期权
+	if theta*x > 0 {
+		beta -= math.Abs(2 * math.Sinh(x/2))
+	}
+	// 虚值看跌与x取反后的虚值看涨标准化价格相同
+	return -math.Abs(x), beta, scale
+}
+
+// 标准化Black价格及其对s的前三阶导数
+func normalizedBlack(x, s float64) (b, b1, b2, b3 float64) {
+	hp, hm := x/s+s/2, x/s-s/2
+	b = math.Exp(x/2)*Cdf(hp) - math.Exp(-x/2)*Cdf(hm)
+	b1 = math.Exp(-0.5*(x*x/(s*s)+s*s/4)) / math.Sqrt(2*math.Pi)
+	u := x*x/(s*s*s) - s/4
+	b2 = b1 * u
+	b3 = b1 * (u*u - 3*x*x/(s*s*s*s) - 0.25)
+	return
+}
+
+// 计算 normalizedBlack 时的舍入误差量级, 残差不超过该值时视为收敛
+// 两项相减前各自的相对误差约为 (1+h^2)eps, h^2 来自N(h)的参数h的舍入误差
+func normalizedBlackNoise(x, s, beta float64) float64 {
+	hp, hm := x/s+s/2, x/s-s/2
+	terms := math.Exp(x/2)*Cdf(hp) + math.Exp(-x/2)*Cdf(hm)
+	return 4 * dblEpsilon * math.Max((1+math.Max(hp*hp, hm*hm))*terms, beta)
+}
+
+// 标准正态分布的分位数
+func invCdf(p float64) float64 {
+	return -math.Sqrt2 * math.Erfcinv(2*p)
+}
+
+// 有理三次插值: 区间[xl, xr]端点的值为 yl, yr, 导数为 dl, dr, r 为控制参数, r=3 时为三次Hermite插值, r 很大时退化为线性插值
+func rationalCubic(x, xl, xr, yl, yr, dl, dr, r float64) float64 {
+	h := xr - xl
+	if math.Abs(h) <= 0 {
+		return (yl + yr) / 2
+	}
+	t := (x - xl) / h
+	if !(r < rationalCubicMaxR) {
+		return yr*t + yl*(1-t)
+	}
+	omt := 1 - t
+	return (yr*t*t*t + (r*yr-h*dr)*t*t*omt + (r*yl+h*dl)*t*omt*omt + yl*omt*omt*omt) / (1 + (r-3)*t*omt)
+}
+
+// 保持插值单调/凸性所需的最小控制参数, slope 为区间的割线斜率
+func rationalCubicMinControl(dl, dr, slope float64, preferShape bool) float64 {
+	monotonic := dl*slope >= 0 && dr*slope >= 0
+	convex := dl <= slope && slope <= dr
+	concave := dl >= slope && slope >= dr
+	if !monotonic && !convex && !concave {
+		return rationalCubicMinR
+	}
+	r1, r2 := -math.MaxFloat64, -math.MaxFloat64
+	if monotonic {
+		if slope != 0 {
+			r1 = (dr + dl) / slope
+		} else if preferShape {
+			r1 = rationalCubicMaxR
+		}
+	}
+	if convex || concave {
+		if slope-dl != 0 && dr-slope != 0 {
+			r2 = math.Max(math.Abs((dr-dl)/(dr-slope)), math.Abs((dr-dl)/(slope-dl)))
+		} else if preferShape {
+			r2 = rationalCubicMaxR
+		}
+	} else if monotonic && preferShape {
+		r2 = rationalCubicMaxR
+	}
+	return math.Max(rationalCubicMinR, math.Max(r1, r2))
+}
+
+// 使插值在左端(left为true)或右端的二阶导数为 d2 的控制参数, 且不小于保持形状所需的最小值
+func rationalCubicControl(xl, xr, yl, yr, dl, dr, d2 float64, left, preferShape bool) float64 {
+	h := xr - xl
+	slope := (yr - yl) / h
+	numerator := h*d2/2 + (dr - dl)
+	denominator := dr - slope
+	if left {
+		denominator = slope - dl
+	}
+	r := 0.0
+	if numerator != 0 {
+		if denominator == 0 {
+			r = rationalCubicMinR
+			if numerator > 0 {
+				r = rationalCubicMaxR
+			}
+		} else {
+			r = numerator / denominator
+		}
+	}
+	return math.Max(r, rationalCubicMinControl(dl, dr, slope, preferShape))
+}
+
+// 最低区域的变换 f = 2π|x|/(3√3) N(-|x|/(√3 s))^3, 在 s->0 时与标准化价格渐近一致, 返回 f 及其对价格的一、二阶导数
+func lowerMap(x, s float64) (f, fp, fpp float64) {
+	ax := math.Abs(x)
+	z := ax / (math.Sqrt(3) * s)
+	y := z * z
+	phi := Cdf(-z)
+	pdf := math.Exp(-y/2) / math.Sqrt(2*math.Pi)
+	e := math.Exp(y + s*s/8)
+	f = 2 * math.Pi / math.Sqrt(27) * ax * phi * phi * phi
+	fp = 2 * math.Pi * y * phi * phi * e
+	// fp 对 s 求导后除以 vega
+	dy := -2 * y / s
+	dfp := 2 * math.Pi * e * (dy*phi*phi + 2*y*phi*pdf*z/s + y*phi*phi*(dy+s/4))
+	fpp = dfp * math.Sqrt(2*math.Pi) * math.Exp(0.5*(x*x/(s*s)+s*s/4))
+	return
+}
+
+func inverseLowerMap(x, f float64) float64 {
+	if f <= 0 {
+		return 0
+	}
+	return math.Abs(x / (math.Sqrt(3) * invCdf(math.Cbrt(f/(2*math.Pi/math.Sqrt(27)*math.Abs(x))))))
+}
+
+// 最高区域的变换 f = N(-s/2), 在价格趋于上界时与 (上界-价格) 渐近成比例, 返回 f 及其对价格的一、二阶导数
+func upperMap(x, s float64) (f, fp, fpp float64) {
+	f = Cdf(-s / 2)
+	w := (x / s) * (x / s)
+	fp = -0.5 * math.Exp(w/2)
+	fpp = math.Sqrt(math.Pi/2) * math.Exp(w+s*s/8) * w / s
+	return
+}
+
+const (
+	rationalLowest = iota // beta < bl, 对 1/ln(b) 迭代
+	rationalMiddle        // bl <= beta < bu, 对 b 迭代
+	rationalUpper         // beta >= bu, 对 ln(上界-b) 迭代
+)
+
+// 分段有理初值, 返回初值, 所在区域以及包含解的区间
+func rationalInitial(x, beta float64) (s float64, region int, lo, hi float64) {
+	bMax := math.Exp(x / 2)
+	sc := math.Sqrt(2 * math.Abs(x))
+	bc, vc, _, _ := normalizedBlack(x, sc)
+	// 拐点处切线与 b=0, b=bMax 的交点
+	sl, su := sc-bc/vc, sc+(bMax-bc)/vc
+	bl, vl := 0.0, 0.0
+	if sl > 0 {
+		bl, vl, _, _ = normalizedBlack(x, sl)
+	}
+	bu, vu, _, _ := normalizedBlack(x, su)
+
+	switch {
+	case beta < bl:
+		fl, fpl, fppl := lowerMap(x, sl)
+		r := rationalCubicControl(0, bl, 0, fl, 1, fpl, fppl, false, true)
+		f := rationalCubic(beta, 0, bl, 0, fl, 1, fpl, r)
+		if !(f > 0) {
+			// 极端参数下插值被舍入为非正, 改用 f(0)=0, f'(0)=1 和 f(bl) 确定的二次插值
+			t := beta / bl
+			f = (fl*t + bl*(1-t)) * t
+		}
+		return inverseLowerMap(x, f), rationalLowest, 0, sl
+	case beta < bc:
+		r := rationalCubicControl(bl, bc, sl, sc, 1/vl, 1/vc, 0, false, false)
+		return rationalCubic(beta, bl, bc, sl, sc, 1/vl, 1/vc, r), rationalMiddle, math.Max(sl, 0), sc
+	case beta < bu:
+		r := rationalCubicControl(bc, bu, sc, su, 1/vc, 1/vu, 0, true, false)
+		return rationalCubic(beta, bc, bu, sc, su, 1/vc, 1/vu, r), rationalMiddle, sc, su
+	}
+	fu, fpu, fppu := upperMap(x, su)
+	f := 0.0
+	if !math.IsInf(fppu, 0) && !math.IsNaN(fppu) {
+		r := rationalCubicControl(bu, bMax, fu, 0, fpu, -0.5, fppu, true, true)
+		f = rationalCubic(beta, bu, bMax, fu, 0, fpu, -0.5, r)
+	}
+	if f <= 0 {
+		h := bMax - bu
+		t := (beta - bu) / h
+		f = (fu*(1-t) + 0.5*h*t) * (1 - t)
+	}
+	return -2 * invCdf(f), rationalUpper, su, math.Inf(1)
+}
+
+// 求解 b(x, s) = beta, 返回 s = iv*sqrt(T), 迭代次数以及是否收敛
+// 残差不超过计算标准化价格的舍入误差, 或步长小于几个ulp时视为收敛
+func rationalImVol(x, beta float64, maxExecTimes int) (float64, int, bool) {
+	if x == 0 {
+		// 平值: b = 2N(s/2) - 1
+		return 2 * math.Sqrt2 * math.Erfinv(beta), 0, true
+	}
+	bMax := math.Exp(x / 2)
+	if !(beta > 0 && beta < bMax) {
+		return math.NaN(), 0, false
+	}
+	s, region, lo, hi := rationalInitial(x, beta)
+	if !(s > lo && s < hi) {
+		s = (lo + math.Min(hi, 2*math.Max(lo, math.Sqrt(2*math.Abs(x))))) / 2
+	}
+
+	for i := 0; ; i++ {
+		b, b1, b2, b3 := normalizedBlack(x, s)
+		if math.Abs(b-beta) <= normalizedBlackNoise(x, s, beta) {
+			return s, i, true
+		}
+		if i == maxExecTimes {
+			return s, maxExecTimes, false
+		}
+		if b > beta {
+			hi = math.Min(hi, s)
+		} else {
+			lo = math.Max(lo, s)
+		}
+
+		var nu, h2, h3 float64
+		valid := b1 > 0
+		switch region {
+		case rationalLowest:
+			// g = 1/ln(b) - 1/ln(beta)
+			valid = valid && b > 0
+			lnB, lnBeta := math.Log(b), math.Log(beta)
+			q := b1 / b
+			lambda := 1 / lnB
+			u := b2 / b1
+			nu = (lnBeta - lnB) * lnB / lnBeta / q
+			h2 = u - q*(1+2*lambda)
+			h3 = b3/b1 + q*q*(2+6*lambda*(1+lambda)) - u*q*3*(1+2*lambda)
+		case rationalUpper:
+			// g = ln((bMax-beta)/(bMax-b))
+			valid = valid && b < bMax
+			d := bMax - b
+			gp := b1 / d
+			u := b2 / b1
+			nu = -math.Log((bMax-beta)/d) / gp
+			h2 = u + gp
+			h3 = b3/b1 + gp*(2*gp+3*u)
+		default:
+			nu, h2, h3 = (beta-b)/b1, b2/b1, b3/b1
+		}
+		next := s + math.Max(-s/2, nu*(1+h2*nu/2)/(1+nu*(h2+h3*nu/6)))
+		// Householder步长跳出区间时退化为牛顿法或二分
+		if !valid || !(next > lo && next < hi) {
+			next = s + nu
+		}
+		if !valid || !(next > lo && next < hi) {
+			if math.IsInf(hi, 1) {
+				next = 2 * s
+			} else {
+				next = (lo + hi) / 2
+			}
+		}
+		if math.Abs(next-s) <= 2*dblEpsilon*s {
+			return next, i + 1, true
+		}
+		s = next
+	}
+}
+
+// 使用指定的求解器计算隐含波动率, 仅在求解成功时更新bsm.Iv, 并按新的Iv重新计算d1, d2及希腊值
+func (bsm *BSM) ImVolWithSolver(solver IvSolver) (*IvResult, error) {
+	res, err := solver.ImVol(bsm)
+	if err != nil {
+		return res, err
+	}
+	bsm.Iv = res.Iv
+	bsm.Init()
+	return res, nil
+}
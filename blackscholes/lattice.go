@@ -0,0 +1,208 @@
+package blackscholes
+
+import (
+	"math"
+	"strings"
+)
+
+const (
+	LatticeBinomial  = "binomial"  // Cox-Ross-Rubinstein 二叉树
+	LatticeTrinomial = "trinomial" // 三叉树
+)
+
+// 树模型期权定价, 支持美式提前行权
+// see wiki: https://en.wikipedia.org/wiki/Binomial_options_pricing_model
+type Lattice struct {
+	Kind      string  `json:"kind"`          // 树类型 binomial / trinomial
+	D         string  `json:"direction"`     // direction 期权方向 看涨：c 看跌：p
+	American  bool    `json:"american"`      // 是否可以提前行权
+	Steps     int     `json:"steps"`         // 树的步数
+	S         float64 `json:"subject_price"` // subjectPrice期权标的价格（指数价格）
+	X         float64 `json:"strike_price"`  // 期权行权价格（敲定价格）
+	T         float64 `json:"rest_time"`     // （期权到期日-当前时间）/365天
+	R         float64 `json:"price_rate"`    // 计价币种的利率
+	Q         float64 `json:"dividend_rate"` // 标的连续分红率/外币利率
+	Iv        float64 `json:"volatility"`    // 年化波动率
+	IvMax     float64 `json:"iv_max"`        // 年化波动最大值
+	IvMin     float64 `json:"iv_min"`        // 年化波动最小
+	Op        float64 `json:"option_price"`  // 期权报价
+	OpEpsilon float64 `json:"op_epsilon"`    // 价格精度0.0001
+	Price     float64 `json:"price"`         // 按Iv计算的树模型价格
+	Delta     float64 `json:"delta"`         // 希腊值delta, 由树节点差分得到
+	Gamma     float64 `json:"gamma"`         // 希腊值gamma, 由树节点差分得到
+	Vega      float64 `json:"vega"`          // 希腊值vega, 波动率上下平移1%(Iv较小时平移Iv/2)重新定价, 按波动率变化1%计
+	Theta     float64 `json:"theta"`         // 希腊值theta, 由树节点差分得到
+	Rho       float64 `json:"rho"`           // 希腊值rho, 利率上下平移1%重新定价
+}
+
+func NewLattice(kind string, direction string, american bool, steps int, S float64, X float64, T float64, r float64, q float64, op float64, opEpsilon float64, ivMax float64, ivMin float64) *Lattice {
+	l := Lattice{
+		Kind:      strings.ToLower(kind),
+		D:         strings.ToLower(direction),
+		American:  american,
+		Steps:     steps,
+		S:         S,
+		X:         X,
+		T:         T,
+		R:         r,
+		Q:         q,
+		Op:        op,
+		OpEpsilon: opEpsilon,
+		IvMax:     ivMax,
+		IvMin:     ivMin,
+	}
+	l.Init()
+	return &l
+}
+
+func NewLatticeWithIv(kind string, direction string, american bool, steps int, S float64, X float64, T float64, r float64, q float64, op float64, opEpsilon float64, ivMax float64, ivMin float64, iv float64) *Lattice {
+	l := Lattice{
+		Kind:      strings.ToLower(kind),
+		D:         strings.ToLower(direction),
+		American:  american,
+		Steps:     steps,
+		S:         S,
+		X:         X,
+		T:         T,
+		R:         r,
+		Q:         q,
+		Op:        op,
+		OpEpsilon: opEpsilon,
+		Iv:        iv,
+		IvMax:     ivMax,
+		IvMin:     ivMin,
+	}
+	l.Init()
+	return &l
+}
+
+func (l *Lattice) Init() {
+	if l.Steps < 3 {
+		l.Steps = 3
+	}
+	// 计算波动率, 失败时Iv保持为0
+	if l.Iv == 0 {
+		if _, err := l.ImVolBisection(); err == nil {
+			return
+		}
+	}
+	// Iv不为正时树退化(u=d), 不计算价格和希腊值
+	if l.Iv <= 0 {
+		return
+	}
+
+	l.Price, l.Delta, l.Gamma, l.Theta = l.tree(l.Iv, l.R)
+	l.Theta = l.Theta / 365
+	// 波动率上下平移1%, Iv较小时按Iv/2平移, 避免平移后波动率不为正
+	h := math.Min(0.01, l.Iv/2)
+	l.Vega = (l.GetOptionPriceFromIv(l.Iv+h) - l.GetOptionPriceFromIv(l.Iv-h)) / (2 * h) * 0.01
+	up, _, _, _ := l.tree(l.Iv, l.R+0.01)
+	down, _, _, _ := l.tree(l.Iv, l.R-0.01)
+	l.Rho = (up - down) / 2
+}
+
+// 割线法+二分法求隐含波动率, 仅在求解成功时更新Iv并重新计算
+func (l *Lattice) ImVolBisection() (*IvResult, error) {
+	res, err := solveBisection(l.Op, l.OpEpsilon, l.IvMax, l.IvMin, l.GetOptionPriceFromIv)
+	if err != nil {
+		return res, err
+	}
+	l.Iv = res.Iv
+	l.Init()
+	return res, nil
+}
+
+// 通过隐含波动率找到对应的期权报价
+func (l *Lattice) GetOptionPriceFromIv(iv float64) float64 {
+	price, _, _, _ := l.tree(iv, l.R)
+	return price
+}
+
+func (l *Lattice) payoff(s float64) float64 {
+	if l.D == "c" {
+		return math.Max(s-l.X, 0)
+	} else if l.D == "p" {
+		return math.Max(l.X-s, 0)
+	}
+	return 0
+}
+
+// 倒推树, 返回价格以及由树节点得到的delta, gamma, theta(年化)
+func (l *Lattice) tree(iv float64, r float64) (price, delta, gamma, theta float64) {
+	if l.Kind == LatticeTrinomial {
+		return l.trinomial(iv, r)
+	}
+	return l.binomial(iv, r)
+}
+
+func (l *Lattice) binomial(iv float64, r float64) (price, delta, gamma, theta float64) {
+	n := l.Steps
+	dt := l.T / float64(n)
+	u := math.Exp(iv * math.Sqrt(dt))
+	d := 1 / u
+	p := (math.Exp((r-l.Q)*dt) - d) / (u - d)
+	df := math.Exp(-r * dt)
+
+	values := make([]float64, n+1)
+	for j := 0; j <= n; j++ {
+		values[j] = l.payoff(l.S * math.Pow(u, float64(2*j-n)))
+	}
+	var v1, v2 [3]float64
+	for i := n - 1; i >= 0; i-- {
+		for j := 0; j <= i; j++ {
+			values[j] = df * (p*values[j+1] + (1-p)*values[j])
+			if l.American {
+				values[j] = math.Max(values[j], l.payoff(l.S*math.Pow(u, float64(2*j-i))))
+			}
+		}
+		if i == 2 {
+			copy(v2[:], values[:3])
+		} else if i == 1 {
+			copy(v1[:], values[:2])
+		}
+	}
+	price = values[0]
+
+	su, sd, suu, sdd := l.S*u, l.S*d, l.S*u*u, l.S*d*d
+	delta = (v1[1] - v1[0]) / (su - sd)
+	gamma = ((v2[2]-v2[1])/(suu-l.S) - (v2[1]-v2[0])/(l.S-sdd)) / ((suu - sdd) / 2)
+	theta = (v2[1] - price) / (2 * dt)
+	return
+}
+
+func (l *Lattice) trinomial(iv float64, r float64) (price, delta, gamma, theta float64) {
+	n := l.Steps
+	dt := l.T / float64(n)
+	u := math.Exp(iv * math.Sqrt(2*dt))
+	d := 1 / u
+	a, eh, el := math.Exp((r-l.Q)*dt/2), math.Exp(iv*math.Sqrt(dt/2)), math.Exp(-iv*math.Sqrt(dt/2))
+	pu := math.Pow((a-el)/(eh-el), 2)
+	pd := math.Pow((eh-a)/(eh-el), 2)
+	pm := 1 - pu - pd
+	df := math.Exp(-r * dt)
+
+	// 第i步共2i+1个节点, 下标j对应价格S*u^(j-i)
+	values := make([]float64, 2*n+1)
+	for j := 0; j <= 2*n; j++ {
+		values[j] = l.payoff(l.S * math.Pow(u, float64(j-n)))
+	}
+	var v1 [3]float64
+	for i := n - 1; i >= 0; i-- {
+		for j := 0; j <= 2*i; j++ {
+			values[j] = df * (pu*values[j+2] + pm*values[j+1] + pd*values[j])
+			if l.American {
+				values[j] = math.Max(values[j], l.payoff(l.S*math.Pow(u, float64(j-i))))
+			}
+		}
+		if i == 1 {
+			copy(v1[:], values[:3])
+		}
+	}
+	price = values[0]
+
+	su, sd := l.S*u, l.S*d
+	delta = (v1[2] - v1[0]) / (su - sd)
+	gamma = ((v1[2]-v1[1])/(su-l.S) - (v1[1]-v1[0])/(l.S-sd)) / ((su - sd) / 2)
+	theta = (v1[1] - price) / dt
+	return
+}
@@ -0,0 +1,208 @@
+package montecarlo
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"runtime"
+	"sync"
+
+	"github.com/charlerive/library/blackscholes"
+)
+
+// 每批路径数, 每批的随机数种子由 Seed 和批次号经 splitmix64 混合得到, 结果与协程数无关
+const batchSize = 1024
+
+var ErrInvalidEngine = errors.New("montecarlo: invalid engine config")
+
+// 路径模型, 状态的第0个元素为标的价格, 其余为模型自身状态(如随机波动率模型的方差)
+// 各批次在多个协程中同时调用 InitState 和 Evolve, 实现需并发安全(不修改模型自身的字段), 状态只保存在 state 中
+type Model interface {
+	Factors() int                                               // 每一步需要的独立标准正态随机数个数
+	InitState() []float64                                       // 初始状态
+	Evolve(state []float64, t float64, dt float64, z []float64) // 将状态由t演化到t+dt, 原地修改
+}
+
+// 几何布朗运动, 按对数精确离散
+type GBM struct {
+	S  float64 `json:"subject_price"` // 标的价格
+	R  float64 `json:"price_rate"`    // 计价币种的利率
+	Q  float64 `json:"dividend_rate"` // 标的连续分红率/外币利率
+	Iv float64 `json:"volatility"`    // 年化波动率
+}
+
+func NewGBM(S float64, r float64, q float64, iv float64) *GBM {
+	return &GBM{S: S, R: r, Q: q, Iv: iv}
+}
+
+func (g *GBM) Factors() int {
+	return 1
+}
+
+func (g *GBM) InitState() []float64 {
+	return []float64{g.S}
+}
+
+func (g *GBM) Evolve(state []float64, t float64, dt float64, z []float64) {
+	state[0] *= math.Exp((g.R-g.Q-g.Iv*g.Iv/2)*dt + g.Iv*math.Sqrt(dt)*z[0])
+}
+
+// 到期收益, path 为 t=0, dt, ..., T 时刻的标的价格, 共 Steps+1 个, 同样会被多个协程同时调用
+type Payoff func(path []float64) float64
+
+// 控制变量, Payoff 的折现期望为已知的 Price
+type ControlVariate struct {
+	Payoff Payoff
+	Price  float64
+}
+
+// 以普通欧式期权作为控制变量, 期望价格由BSM解析解给出
+func NewVanillaControl(direction string, S float64, X float64, T float64, r float64, q float64, iv float64) *ControlVariate {
+	bsm := blackscholes.NewBSQWithIv(direction, S, X, T, r, q, 0, 0.0001, 3, 0.01, iv)
+	return &ControlVariate{
+		Payoff: VanillaPayoff(direction, X),
+		Price:  bsm.GetOptionPriceFromIv(iv),
+	}
+}
+
+type Engine struct {
+	Model      Model           // 路径模型
+	T          float64         // （期权到期日-当前时间）/365天
+	R          float64         // 折现利率
+	Steps      int             // 时间步数
+	Paths      int             // 样本数, 使用对偶变量时每个样本为一对路径
+	Seed       int64           // 随机数种子, 相同配置下结果可复现
+	Workers    int             // 并发协程数, <=0 时为CPU核数
+	Antithetic bool            // 是否使用对偶变量
+	Control    *ControlVariate // 控制变量, 为nil时不使用
+}
+
+type Result struct {
+	Price  float64 `json:"price"`   // 估计价格
+	StdErr float64 `json:"std_err"` // 标准误差
+	Paths  int     `json:"paths"`   // 样本数
+	Beta   float64 `json:"beta"`    // 控制变量系数
+}
+
+// 单批样本的累加量
+type moments struct {
+	n                               int
+	sumY, sumYY, sumC, sumCC, sumYC float64
+}
+
+func (m *moments) add(o moments) {
+	m.n += o.n
+	m.sumY += o.sumY
+	m.sumYY += o.sumYY
+	m.sumC += o.sumC
+	m.sumCC += o.sumCC
+	m.sumYC += o.sumYC
+}
+
+func (e *Engine) Price(payoff Payoff) (*Result, error) {
+	if e.Model == nil || payoff == nil || e.Steps <= 0 || e.Paths < 2 || e.T <= 0 {
+		return nil, ErrInvalidEngine
+	}
+	workers := e.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	batches := (e.Paths + batchSize - 1) / batchSize
+	results := make([]moments, batches)
+	jobs := make(chan int, batches)
+	for i := 0; i < batches; i++ {
+		jobs <- i
+	}
+	close(jobs)
+
+	wg := sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				n := batchSize
+				if i == batches-1 {
+					n = e.Paths - i*batchSize
+				}
+				results[i] = e.runBatch(payoff, batchSeed(e.Seed, i), n)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// 按批次顺序汇总, 保证结果与协程调度无关
+	var m moments
+	for _, r := range results {
+		m.add(r)
+	}
+	n := float64(m.n)
+	meanY := m.sumY / n
+	varY := (m.sumYY - n*meanY*meanY) / (n - 1)
+	res := Result{Price: meanY, StdErr: math.Sqrt(varY / n), Paths: m.n}
+	if e.Control != nil {
+		meanC := m.sumC / n
+		varC := (m.sumCC - n*meanC*meanC) / (n - 1)
+		covYC := (m.sumYC - n*meanY*meanC) / (n - 1)
+		if varC > 0 {
+			res.Beta = covYC / varC
+		}
+		res.Price = meanY - res.Beta*(meanC-e.Control.Price)
+		res.StdErr = math.Sqrt(math.Max(varY-2*res.Beta*covYC+res.Beta*res.Beta*varC, 0) / n)
+	}
+	return &res, nil
+}
+
+// 批次种子, 使用 splitmix64 混合, 避免相邻 Seed 的批次共用随机数序列
+func batchSeed(seed int64, batch int) int64 {
+	z := uint64(seed) + uint64(batch+1)*0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return int64(z ^ (z >> 31))
+}
+
+func (e *Engine) runBatch(payoff Payoff, seed int64, n int) moments {
+	rng := rand.New(rand.NewSource(seed))
+	dt := e.T / float64(e.Steps)
+	df := math.Exp(-e.R * e.T)
+	factors := e.Model.Factors()
+	z := make([]float64, e.Steps*factors)
+	path := make([]float64, e.Steps+1)
+	zs := make([]float64, factors)
+
+	// 按给定随机数生成一条路径, 返回折现后的收益与控制变量
+	run := func(sign float64) (y float64, c float64) {
+		state := e.Model.InitState()
+		path[0] = state[0]
+		for i := 0; i < e.Steps; i++ {
+			for j := range zs {
+				zs[j] = sign * z[i*factors+j]
+			}
+			e.Model.Evolve(state, float64(i)*dt, dt, zs)
+			path[i+1] = state[0]
+		}
+		y = df * payoff(path)
+		if e.Control != nil {
+			c = df * e.Control.Payoff(path)
+		}
+		return y, c
+	}
+
+	m := moments{n: n}
+	for k := 0; k < n; k++ {
+		for i := range z {
+			z[i] = rng.NormFloat64()
+		}
+		y, c := run(1)
+		if e.Antithetic {
+			y2, c2 := run(-1)
+			y, c = (y+y2)/2, (c+c2)/2
+		}
+		m.sumY += y
+		m.sumYY += y * y
+		m.sumC += c
+		m.sumCC += c * c
+		m.sumYC += y * c
+	}
+	return m
+}
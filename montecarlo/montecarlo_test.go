@@ -0,0 +1,85 @@
+package montecarlo
+
+import (
+	"math"
+	"testing"
+
+	"github.com/charlerive/library/blackscholes"
+)
+
+func TestEngine_Vanilla(t *testing.T) {
+	S, X, T, r, q, iv := 100.0, 105.0, 0.5, 0.05, 0.02, 0.4
+	for _, d := range []string{"c", "p"} {
+		want := blackscholes.NewBSQWithIv(d, S, X, T, r, q, 0, 0.0001, 3, 0.01, iv).GetOptionPriceFromIv(iv)
+		plain := Engine{Model: NewGBM(S, r, q, iv), T: T, R: r, Steps: 1, Paths: 50000, Seed: 1}
+		res, err := plain.Price(VanillaPayoff(d, X))
+		if err != nil || math.Abs(res.Price-want) > 4*res.StdErr {
+			t.Errorf("%s plain: %+v, want %v, err: %v", d, res, want, err)
+		}
+		anti := plain
+		anti.Antithetic = true
+		resAnti, err := anti.Price(VanillaPayoff(d, X))
+		if err != nil || math.Abs(resAnti.Price-want) > 4*resAnti.StdErr || resAnti.StdErr >= res.StdErr {
+			t.Errorf("%s antithetic: %+v, plain %+v, want %v, err: %v", d, resAnti, res, want, err)
+		}
+	}
+}
+
+func TestEngine_Reproducible(t *testing.T) {
+	e := Engine{Model: NewGBM(100, 0.05, 0, 0.5), T: 0.25, R: 0.05, Steps: 20, Paths: 5000, Seed: 42, Workers: 1, Antithetic: true}
+	payoff := ArithmeticAsianPayoff("c", 100, 1)
+	res1, _ := e.Price(payoff)
+	e.Workers = 8
+	res8, _ := e.Price(payoff)
+	if *res1 != *res8 {
+		t.Errorf("workers=1 %+v, workers=8 %+v", res1, res8)
+	}
+	e.Seed = 43
+	if res, _ := e.Price(payoff); res.Price == res1.Price {
+		t.Errorf("different seed gives same price %v", res.Price)
+	}
+	// 相邻种子的批次不共用随机数序列
+	seeds := make(map[int64]bool)
+	for seed := int64(0); seed < 10; seed++ {
+		for i := 0; i < 10; i++ {
+			seeds[batchSeed(seed, i)] = true
+		}
+	}
+	if len(seeds) != 100 {
+		t.Errorf("batch seeds overlap: %d distinct of 100", len(seeds))
+	}
+	if _, err := (&Engine{Model: e.Model, T: 1, Steps: 0, Paths: 100}).Price(payoff); err != ErrInvalidEngine {
+		t.Errorf("err: %v, want %v", err, ErrInvalidEngine)
+	}
+}
+
+func TestEngine_ControlVariate(t *testing.T) {
+	S, X, T, r, q, iv := 100.0, 100.0, 0.5, 0.05, 0.02, 0.5
+	e := Engine{Model: NewGBM(S, r, q, iv), T: T, R: r, Steps: 50, Paths: 20000, Seed: 7}
+	payoff := ArithmeticAsianPayoff("c", X, 1)
+	plain, _ := e.Price(payoff)
+	e.Control = NewVanillaControl("c", S, X, T, r, q, iv)
+	cv, _ := e.Price(payoff)
+	if cv.StdErr >= 0.6*plain.StdErr || math.Abs(cv.Price-plain.Price) > 4*plain.StdErr {
+		t.Errorf("control variate %+v, plain %+v", cv, plain)
+	}
+
+	// 控制变量与收益相同时估计值为解析解, 误差为0
+	res, _ := e.Price(VanillaPayoff("c", X))
+	if math.Abs(res.Price-e.Control.Price) > 1e-10 || res.StdErr > 1e-10 || math.Abs(res.Beta-1) > 1e-10 {
+		t.Errorf("self control: %+v, want %v", res, e.Control.Price)
+	}
+}
+
+func TestEngine_Barrier(t *testing.T) {
+	// 每日观察的敲出期权与 Broadie-Glasserman 修正后的解析解比较
+	S, X, H, T, r, q, iv := 100.0, 100.0, 90.0, 0.25, 0.05, 0.0, 0.3
+	steps := 91
+	e := Engine{Model: NewGBM(S, r, q, iv), T: T, R: r, Steps: steps, Paths: 20000, Seed: 3, Antithetic: true,
+		Control: NewVanillaControl("c", S, X, T, r, q, iv)}
+	res, _ := e.Price(BarrierPayoff(blackscholes.BarrierDownOut, "c", X, H, 0))
+	want := blackscholes.NewBarrier(blackscholes.BarrierDownOut, "c", S, X, H, 0, T, r, q, iv, T/float64(steps)).Price
+	if math.Abs(res.Price-want) > 4*res.StdErr+0.01*want {
+		t.Errorf("down-and-out: %+v, want %v", res, want)
+	}
+}
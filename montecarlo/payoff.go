@@ -0,0 +1,68 @@
+package montecarlo
+
+import (
+	"math"
+	"strings"
+
+	"github.com/charlerive/library/blackscholes"
+)
+
+func intrinsic(direction string, S float64, X float64) float64 {
+	if direction == "p" {
+		return math.Max(X-S, 0)
+	}
+	return math.Max(S-X, 0)
+}
+
+// 普通欧式期权
+func VanillaPayoff(direction string, X float64) Payoff {
+	direction = strings.ToLower(direction)
+	return func(path []float64) float64 {
+		return intrinsic(direction, path[len(path)-1], X)
+	}
+}
+
+// 算术平均价格期权, 对 path[from:] 取平均, from=0 时包含当前价格
+func ArithmeticAsianPayoff(direction string, X float64, from int) Payoff {
+	direction = strings.ToLower(direction)
+	return func(path []float64) float64 {
+		var sum float64
+		for _, s := range path[from:] {
+			sum += s
+		}
+		return intrinsic(direction, sum/float64(len(path)-from), X)
+	}
+}
+
+// 几何平均价格期权, 对 path[from:] 取平均
+func GeometricAsianPayoff(direction string, X float64, from int) Payoff {
+	direction = strings.ToLower(direction)
+	return func(path []float64) float64 {
+		var sum float64
+		for _, s := range path[from:] {
+			sum += math.Log(s)
+		}
+		return intrinsic(direction, math.Exp(sum/float64(len(path)-from)), X)
+	}
+}
+
+// 离散观察的单障碍期权, 在每个时间步观察, 障碍类型同 blackscholes.BarrierDownIn 等
+// 与解析解不同, 敲出补偿金在到期时支付
+func BarrierPayoff(barrierType string, direction string, X float64, H float64, rebate float64) Payoff {
+	barrierType, direction = strings.ToLower(barrierType), strings.ToLower(direction)
+	down := barrierType == blackscholes.BarrierDownIn || barrierType == blackscholes.BarrierDownOut
+	in := barrierType == blackscholes.BarrierDownIn || barrierType == blackscholes.BarrierUpIn
+	return func(path []float64) float64 {
+		hit := false
+		for _, s := range path {
+			if (down && s <= H) || (!down && s >= H) {
+				hit = true
+				break
+			}
+		}
+		if hit == in {
+			return intrinsic(direction, path[len(path)-1], X)
+		}
+		return rebate
+	}
+}
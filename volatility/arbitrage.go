@@ -0,0 +1,207 @@
+package volatility
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+const (
+	ArbitrageIgnore = ""       // 不检查
+	ArbitrageReject = "reject" // 存在蝶式套利时拒绝拟合结果
+	ArbitrageRepair = "repair" // 存在蝶式套利时向平值方差的水平曲线收缩
+)
+
+var ErrButterflyArbitrage = errors.New("volatility: fitted smile has butterfly arbitrage")
+
+// 违反无套利条件的连续区间
+type ArbitrageRegion struct {
+	KStart float64 `json:"k_start"` // 区间起点
+	KEnd   float64 `json:"k_end"`   // 区间终点
+	Min    float64 `json:"min"`     // 区间内 g(k) 的最小值, 总方差非正时为 -Inf
+}
+
+type ButterflyReport struct {
+	KGrid   []float64          `json:"k_grid"`
+	G       []float64          `json:"g"`       // 各网格点的 g(k)
+	Regions []*ArbitrageRegion `json:"regions"` // g(k)<0 的区间
+}
+
+// 无蝶式套利
+func (r *ButterflyReport) Free() bool {
+	return len(r.Regions) == 0
+}
+
+// [kMin, kMax] 上的等距网格
+func KGrid(kMin, kMax float64, n int) []float64 {
+	if n < 2 {
+		return []float64{kMin}
+	}
+	grid := make([]float64, n)
+	for i := range grid {
+		grid[i] = kMin + (kMax-kMin)*float64(i)/float64(n-1)
+	}
+	return grid
+}
+
+// raw SVI 的密度函数 g(k) = (1 - kw'/(2w))^2 - w'^2/4*(1/w + 1/4) + w”/2, g<0 时存在蝶式套利
+// see: Gatheral & Jacquier, Arbitrage-free SVI volatility surfaces
+func SviG(k float64, p *Params) float64 {
+	kM := k - p.Eta
+	sq := math.Sqrt(kM*kM + p.C*p.C)
+	w := Variance(kM, p.A, p.B, p.C, p.Rho)
+	if w <= 0 {
+		return math.Inf(-1)
+	}
+	w1 := p.B * (p.Rho + kM/sq)
+	w2 := p.B * p.C * p.C / (sq * sq * sq)
+	return (1-k*w1/(2*w))*(1-k*w1/(2*w)) - w1*w1/4*(1/w+0.25) + w2/2
+}
+
+// 在网格上检查蝶式套利, 返回 g(k) 以及违反的区间
+func CheckButterfly(p *Params, kGrid []float64) *ButterflyReport {
+	report := &ButterflyReport{KGrid: kGrid, G: make([]float64, len(kGrid))}
+	var region *ArbitrageRegion
+	for i, k := range kGrid {
+		g := SviG(k, p)
+		report.G[i] = g
+		if g < 0 || math.IsNaN(g) {
+			if region == nil {
+				region = &ArbitrageRegion{KStart: k, Min: g}
+				report.Regions = append(report.Regions, region)
+			}
+			region.KEnd = k
+			if g < region.Min || math.IsNaN(g) {
+				region.Min = g
+			}
+		} else {
+			region = nil
+		}
+	}
+	return report
+}
+
+// 把参数向平值总方差相同的水平曲线收缩: A(λ) = (1-λ)A + λw(0), B(λ) = (1-λ)B,
+// 用二分法找到网格上无套利的最小λ; 平值总方差非正或水平曲线仍有套利时返回 ErrButterflyArbitrage
+func RepairButterfly(p *Params, kGrid []float64) (*Params, error) {
+	if CheckButterfly(p, kGrid).Free() {
+		return p.Copy(), nil
+	}
+	atm := Variance(-p.Eta, p.A, p.B, p.C, p.Rho)
+	if atm <= 0 {
+		return nil, ErrButterflyArbitrage
+	}
+	blend := func(lambda float64) *Params {
+		q := p.Copy()
+		q.A = (1-lambda)*p.A + lambda*atm
+		q.B = (1 - lambda) * p.B
+		return q
+	}
+	if !CheckButterfly(blend(1), kGrid).Free() {
+		return nil, ErrButterflyArbitrage
+	}
+	lo, hi := 0.0, 1.0
+	for i := 0; i < 50; i++ {
+		mid := (lo + hi) / 2
+		if CheckButterfly(blend(mid), kGrid).Free() {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	return blend(hi), nil
+}
+
+// 拟合后检查用的默认网格: 市场数据两侧各延伸1
+func (s *Volatility) butterflyKGrid() []float64 {
+	if s.ButterflyKGrid != nil {
+		return s.ButterflyKGrid
+	}
+	kMin, kMax := math.Inf(1), math.Inf(-1)
+	for _, md := range s.MarketDataList {
+		kMin, kMax = math.Min(kMin, md.K), math.Max(kMax, md.K)
+	}
+	return KGrid(kMin-1, kMax+1, 401)
+}
+
+// 按 Arbitrage 处理拟合结果, 被拒绝或无法修复时返回 ErrButterflyArbitrage
+func (s *Volatility) checkButterfly(p *Params) (*Params, error) {
+	if s.Arbitrage == ArbitrageIgnore {
+		return p, nil
+	}
+	grid := s.butterflyKGrid()
+	s.ButterflyReport = CheckButterfly(p, grid)
+	if s.ButterflyReport.Free() {
+		return p, nil
+	}
+	switch s.Arbitrage {
+	case ArbitrageReject:
+		return nil, ErrButterflyArbitrage
+	case ArbitrageRepair:
+		repaired, err := RepairButterfly(p, grid)
+		if err != nil {
+			return nil, err
+		}
+		p = repaired
+		s.ButterflyReport = CheckButterfly(p, grid)
+	}
+	return p, nil
+}
+
+var ErrCalendarInput = errors.New("volatility: expiries and models do not match")
+
+// 相邻两个期限之间总方差倒挂的连续区间
+type CalendarRegion struct {
+	T1     float64 `json:"t1"`      // 较近的期限
+	T2     float64 `json:"t2"`      // 较远的期限
+	KStart float64 `json:"k_start"` // 区间起点
+	KEnd   float64 `json:"k_end"`   // 区间终点
+	Max    float64 `json:"max"`     // 区间内 w(k,T1)-w(k,T2) 的最大值
+}
+
+type CalendarReport struct {
+	Ts      []float64         `json:"ts"` // 升序的期限
+	KGrid   []float64         `json:"k_grid"`
+	Regions []*CalendarRegion `json:"regions"` // 总方差随期限下降的区间
+}
+
+// 无日历套利
+func (r *CalendarReport) Free() bool {
+	return len(r.Regions) == 0
+}
+
+// 检查各期限独立拟合的微笑之间的日历套利: 对网格上每个k, 总方差须随期限不减
+// ts[i] 为 models[i] 的期限, 无需有序
+func CheckCalendar(ts []float64, models []SmileModel, kGrid []float64) (*CalendarReport, error) {
+	if len(ts) != len(models) {
+		return nil, ErrCalendarInput
+	}
+	idx := make([]int, len(ts))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.Slice(idx, func(i, j int) bool { return ts[idx[i]] < ts[idx[j]] })
+
+	report := &CalendarReport{Ts: make([]float64, len(ts)), KGrid: kGrid}
+	for i, j := range idx {
+		report.Ts[i] = ts[j]
+	}
+	for n := 1; n < len(idx); n++ {
+		short, long := models[idx[n-1]], models[idx[n]]
+		var region *CalendarRegion
+		for _, k := range kGrid {
+			diff := short.TotalVariance(k) - long.TotalVariance(k)
+			if diff > 0 {
+				if region == nil {
+					region = &CalendarRegion{T1: ts[idx[n-1]], T2: ts[idx[n]], KStart: k}
+					report.Regions = append(report.Regions, region)
+				}
+				region.KEnd = k
+				region.Max = math.Max(region.Max, diff)
+			} else {
+				region = nil
+			}
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,108 @@
+package volatility
+
+import "math"
+
+const FitModeBand = "band" // 拟合买卖价隐含波动率区间, 见 BandFit
+
+// 落在报价区间之外的数据点
+type BandViolation struct {
+	K        float64 `json:"k"`        // 对数行权价格
+	ImVol    float64 `json:"im_vol"`   // 拟合的隐含波动率
+	Bid      float64 `json:"bid"`      // 买价隐含波动率
+	Ask      float64 `json:"ask"`      // 卖价隐含波动率, 无卖价时为 +Inf
+	Distance float64 `json:"distance"` // 到区间的距离, 低于买价为负, 高于卖价为正
+}
+
+type BandReport struct {
+	Violations []*BandViolation `json:"violations"`
+}
+
+// 所有点都在报价区间内
+func (r *BandReport) Inside() bool {
+	return len(r.Violations) == 0
+}
+
+// 数据点的隐含波动率区间, BidV 和 AskV 都为0时退化为 V,
+// 只有一侧为0时视为没有该侧报价
+func (md *MarketData) band() (bid, ask float64) {
+	if md.BidV == 0 && md.AskV == 0 {
+		iv := math.Sqrt(md.V)
+		return iv, iv
+	}
+	bid, ask = math.Sqrt(md.BidV), math.Inf(1)
+	if md.AskV > 0 {
+		ask = math.Sqrt(md.AskV)
+	}
+	return bid, ask
+}
+
+// 隐含波动率到区间的距离, 区间内为0
+func bandDistance(iv, bid, ask float64) float64 {
+	if iv < bid {
+		return iv - bid
+	}
+	if iv > ask {
+		return iv - ask
+	}
+	return 0
+}
+
+// 检查模型在哪些点落在报价区间之外
+func CheckBands(model SmileModel, marketDataList []*MarketData) *BandReport {
+	return checkBands(model.ImVol, marketDataList)
+}
+
+func checkBands(imVol func(k float64) float64, marketDataList []*MarketData) *BandReport {
+	report := &BandReport{}
+	for _, md := range marketDataList {
+		bid, ask := md.band()
+		iv := imVol(md.K)
+		if d := bandDistance(iv, bid, ask); d != 0 || math.IsNaN(iv) {
+			report.Violations = append(report.Violations, &BandViolation{K: md.K, ImVol: iv, Bid: bid, Ask: ask, Distance: d})
+		}
+	}
+	return report
+}
+
+// 拟合买卖价区间: 区间内没有损失, 区间外按距离的平方(乘以权重)惩罚
+// 以区间中点做准显式拟合的结果为初值, 结果存在 BandReport 中
+func (s *Volatility) BandFit(marketDataList []*MarketData) *Params {
+	return s.bandFit(marketDataList, &FitReport{})
+}
+
+// 迭代次数, 终止原因和求解失败记录在 report 中
+func (s *Volatility) bandFit(marketDataList []*MarketData, report *FitReport) *Params {
+	mids := make([]*MarketData, 0, len(marketDataList))
+	for _, md := range marketDataList {
+		bid, ask := md.band()
+		mid := *md
+		if !math.IsInf(ask, 1) {
+			mid.V = (bid + ask) * (bid + ask) / 4
+		} else {
+			mid.V = bid * bid
+		}
+		mids = append(mids, &mid)
+	}
+	start := s.QuasiExplicitFit(mids)
+
+	residual := func(x []float64) []float64 {
+		p := &Params{A: x[0], B: x[1], C: x[2], Rho: x[3], Eta: x[4]}
+		r := make([]float64, len(marketDataList))
+		for i, md := range marketDataList {
+			bid, ask := md.band()
+			r[i] = math.Sqrt(md.weight()) * bandDistance(s.GetImVol(md.K, p), bid, ask)
+		}
+		return r
+	}
+	lower := []float64{math.Inf(-1), 0, 1e-8, -0.999, math.Inf(-1)}
+	upper := []float64{math.Inf(1), math.Inf(1), math.Inf(1), 0.999, math.Inf(1)}
+	res := lmSolve(residual, []float64{start.A, start.B, start.C, start.Rho, start.Eta}, lower, upper, MaxIterations)
+	report.Iterations, report.SolveFailed = res.Iterations, res.SolveFailed
+	report.Termination = TerminationConverged
+	if res.Iterations >= MaxIterations {
+		report.Termination = TerminationMaxIterations
+	}
+	p := &Params{A: res.P[0], B: res.P[1], C: res.P[2], Rho: res.P[3], Eta: res.P[4]}
+	s.BandReport = checkBands(func(k float64) float64 { return s.GetImVol(k, p) }, marketDataList)
+	return p
+}
@@ -0,0 +1,162 @@
+package volatility
+
+import (
+	"errors"
+	"math"
+
+	"gonum.org/v1/gonum/diff/fd"
+	"gonum.org/v1/gonum/optimize"
+)
+
+const (
+	ConstrainedMaxIterations = 30    // 增广拉格朗日外层迭代次数上限
+	ConstrainedTolerance     = 1e-10 // 约束允许的违反量
+)
+
+// 约束拟合的诊断信息
+type ConstrainedReport struct {
+	Objective    float64   `json:"objective"`     // 总方差加权残差的2范数, 与 minimize_slsqp.py 的目标函数相同
+	Constraints  []float64 `json:"constraints"`   // 各约束的值, >=0 时满足
+	MaxViolation float64   `json:"max_violation"` // 约束的最大违反量
+	Iterations   int       `json:"iterations"`    // 外层迭代次数
+	Evaluations  int       `json:"evaluations"`   // 目标函数调用次数
+	Converged    bool      `json:"converged"`
+}
+
+// minimize_slsqp.py 中的不等式约束 g(x)>=0, x = [a, b, rho, eta, c]
+// constraint5 恒为0, 总方差根号项的正性已由 c 的下界保证, 这里省略
+func sviConstraints(x []float64) []float64 {
+	a, b, rho, eta := x[0], x[1], x[2], x[3]
+	right, left := b*eta*(rho+1), b*eta*(rho-1)
+	return []float64{
+		(4-a+right)*(a-right) - b*b*(rho+1)*(rho+1),
+		4 - b*b*(rho+1)*(rho+1),
+		(4-a+left)*(a-left) - b*b*(rho-1)*(rho-1),
+		4 - b*b*(rho-1)*(rho-1),
+	}
+}
+
+// 纯 Go 实现的带约束 SVI 拟合, 约束、边界和初值与 minimize_slsqp.py 相同
+// 用增广拉格朗日法处理不等式约束, 边界通过 x = lo + (hi-lo)(1+sin(y))/2 变换消去, 内层用 BFGS 求解
+// 内层求解出错时返回该错误; 线搜索失败仅在外层未收敛时返回
+func (s *Volatility) MinimizeConstrained(marketDataList []*MarketData) (*Params, *ConstrainedReport, error) {
+	if len(marketDataList) == 0 {
+		return nil, nil, ErrNotEnoughData
+	}
+	kMin, kMax, wMin, wMax := math.Inf(1), math.Inf(-1), math.Inf(1), math.Inf(-1)
+	for _, md := range marketDataList {
+		w := md.V * s.T
+		kMin, kMax = math.Min(kMin, md.K), math.Max(kMax, md.K)
+		wMin, wMax = math.Min(wMin, w), math.Max(wMax, w)
+	}
+	// 目标函数按 wMax 缩放, 总方差全部非正时无法拟合
+	if wMax <= 0 {
+		return nil, nil, ErrNotEnoughData
+	}
+	lower := []float64{0.000001, 0.001, -0.999999, math.Min(2*kMin, 2*kMax), 0.001}
+	upper := []float64{math.Max(wMax, 0.000001), 1, 0.999999, math.Max(2*kMin, 2*kMax), 2}
+	xStart := []float64{wMin / 2, 0.1, -0.5, 0.1, 0.1}
+
+	toX, toY := boxTransform(lower, upper)
+	yStart := toY(xStart)
+
+	// 目标函数按最大总方差缩放, 最优解不变
+	report := &ConstrainedReport{}
+	objective := func(x []float64) float64 {
+		report.Evaluations++
+		sum := 0.0
+		for _, md := range marketDataList {
+			r := (Variance(md.K-x[3], x[0], x[1], x[4], x[2]) - md.V*s.T) / wMax
+			sum += md.weight() * r * r
+		}
+		return sum
+	}
+
+	lambda := make([]float64, 4)
+	penalty := 10.0
+	violation, prev := math.Inf(1), math.Inf(1)
+	var lineSearchErr error
+	y := yStart
+	for report.Iterations < ConstrainedMaxIterations {
+		report.Iterations++
+		lagrangian := func(y []float64) float64 {
+			x := toX(y)
+			f := objective(x)
+			for i, g := range sviConstraints(x) {
+				t := math.Max(0, lambda[i]-penalty*g)
+				f += (t*t - lambda[i]*lambda[i]) / (2 * penalty)
+			}
+			return f
+		}
+		problem := optimize.Problem{
+			Func: lagrangian,
+			Grad: func(grad, y []float64) {
+				fd.Gradient(grad, lagrangian, y, &fd.Settings{Formula: fd.Central})
+			},
+		}
+		// 数值梯度在最优点附近的噪声会使线搜索失败, 此时结果仍然可用, 其他错误直接返回
+		result, err := optimize.Minimize(problem, y, &optimize.Settings{MajorIterations: 200}, &optimize.BFGS{})
+		if err != nil {
+			if !errors.Is(err, optimize.ErrLinesearcherFailure) {
+				return nil, report, err
+			}
+			lineSearchErr = err
+		}
+		f := lagrangian(y)
+		if result != nil && result.F <= f {
+			y, f = result.X, result.F
+		}
+
+		x := toX(y)
+		current := 0.0
+		for i, g := range sviConstraints(x) {
+			lambda[i] = math.Max(0, lambda[i]-penalty*g)
+			current = math.Max(current, -g)
+		}
+		if current <= ConstrainedTolerance && math.Abs(f-prev) <= 1e-10*math.Max(math.Abs(f), 1e-10) {
+			report.Converged = true
+			break
+		}
+		if current > ConstrainedTolerance && current > 0.25*violation {
+			penalty *= 10
+		}
+		violation, prev = current, f
+	}
+
+	if !report.Converged && lineSearchErr != nil {
+		return nil, report, lineSearchErr
+	}
+	x := toX(y)
+	report.Constraints = sviConstraints(x)
+	for _, g := range report.Constraints {
+		report.MaxViolation = math.Max(report.MaxViolation, -g)
+	}
+	report.Objective = math.Sqrt(objective(x)) * wMax
+	s.Params = &Params{A: x[0], B: x[1], C: x[4], Rho: x[2], Eta: x[3]}
+	return s.Params, report, nil
+}
+
+// 边界 [lower, upper] 与无约束空间的变换 x = lo + (hi-lo)(1+sin(y))/2, 以及其逆变换
+func boxTransform(lower, upper []float64) (toX, toY func([]float64) []float64) {
+	toX = func(y []float64) []float64 {
+		x := make([]float64, len(y))
+		for i := range y {
+			x[i] = lower[i] + (upper[i]-lower[i])*(1+math.Sin(y[i]))/2
+		}
+		return x
+	}
+	toY = func(x []float64) []float64 {
+		y := make([]float64, len(x))
+		copy(y, x)
+		clamp(y, lower, upper)
+		for i := range y {
+			if upper[i] > lower[i] {
+				y[i] = math.Asin(2*(y[i]-lower[i])/(upper[i]-lower[i]) - 1)
+			} else {
+				y[i] = 0
+			}
+		}
+		return y
+	}
+	return toX, toY
+}
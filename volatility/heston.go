@@ -0,0 +1,194 @@
+package volatility
+
+import (
+	"math"
+	"math/cmplx"
+	"sort"
+
+	"github.com/charlerive/library/blackscholes"
+)
+
+const (
+	HestonCosN          = 256 // COS展开项数
+	HestonCosL          = 20  // 截断区间宽度(标准差倍数), 厚尾时需较大
+	HestonMaxIterations = 100
+)
+
+type HestonParams struct {
+	V0    float64 // 初始方差
+	Kappa float64 // 均值回归速度
+	Theta float64 // 长期方差
+	Sigma float64 // 波动率的波动率
+	Rho   float64 // 标的与方差的相关系数
+}
+
+func (p *HestonParams) Copy() *HestonParams {
+	return &HestonParams{
+		V0:    p.V0,
+		Kappa: p.Kappa,
+		Theta: p.Theta,
+		Sigma: p.Sigma,
+		Rho:   p.Rho,
+	}
+}
+
+// 单个到期日的市场数据
+type ExpiryData struct {
+	T              float64 // （期权到期日-当前时间）/365天
+	MarketDataList []*MarketData
+}
+
+// Heston 随机波动率模型, 价格以远期价格为单位(F=1)且不折现, 用COS方法定价
+// see: Fang & Oosterlee, A Novel Pricing Method for European Options Based on Fourier-Cosine Series Expansions
+type Heston struct {
+	*HestonParams
+	ExpiryDataList []*ExpiryData
+	N              int     // COS展开项数, 默认HestonCosN
+	L              float64 // 截断区间宽度, 默认HestonCosL
+}
+
+func NewHeston() *Heston {
+	return &Heston{
+		N: HestonCosN,
+		L: HestonCosL,
+	}
+}
+
+// little trap 形式的特征函数 E[exp(iu*ln(F_T/F))], 避免复对数跨分支
+// see: Albrecher et al., The Little Heston Trap
+func (h *Heston) charFunc(u complex128, T float64, p *HestonParams) complex128 {
+	iu := complex(0, 1) * u
+	k := complex(p.Kappa, 0)
+	s := complex(p.Sigma, 0)
+	s2 := s * s
+	a := k - complex(p.Rho, 0)*s*iu
+	d := cmplx.Sqrt(a*a + s2*(iu+u*u))
+	g := (a - d) / (a + d)
+	e := cmplx.Exp(-d * complex(T, 0))
+	c := complex(p.Kappa*p.Theta, 0) / s2 * ((a-d)*complex(T, 0) - 2*cmplx.Log((1-g*e)/(1-g)))
+	dd := complex(p.V0, 0) / s2 * (a - d) * (1 - e) / (1 - g*e)
+	return cmplx.Exp(c + dd)
+}
+
+// ln(F_T/F) 的均值与方差, 用于确定截断区间
+// 记 m = E[∫v dt], 则 c1 = -m/2, c2 = m + σ²/(4κ²)·I2 - ρσ/κ·I1,
+// 其中 I1 = ∫E[v_s](1-e^{-κ(T-s)})ds, I2 = ∫E[v_s](1-e^{-κ(T-s)})²ds
+func hestonCumulants(T float64, p *HestonParams) (c1, c2 float64) {
+	k, s, th, b := p.Kappa, p.Sigma, p.Theta, p.V0-p.Theta
+	e := math.Exp(-k * T)
+	m := th*T + b*(1-e)/k
+	i1 := th*(T-(1-e)/k) + b*((1-e)/k-T*e)
+	i2 := th*(T-2*(1-e)/k+(1-e*e)/(2*k)) + b*((1-e)/k-2*T*e+(e-e*e)/k)
+	return -m / 2, math.Abs(m + s*s/(4*k*k)*i2 - p.Rho*s/k*i1)
+}
+
+// 看跌期权价格, k=ln(X/F)
+func (h *Heston) PutPrice(k, T float64, p *HestonParams) float64 {
+	n, l := h.N, h.L
+	if n <= 0 {
+		n = HestonCosN
+	}
+	if l <= 0 {
+		l = HestonCosL
+	}
+	// y = ln(F_T/X) = x + ln(F_T/F), 看跌收益 X*(1-e^y)^+ 对应 y∈[a, 0]
+	x := -k
+	c1, c2 := hestonCumulants(T, p)
+	a := x + c1 - l*math.Sqrt(c2)
+	b := x + c1 + l*math.Sqrt(c2)
+	if a > 0 {
+		return 0
+	}
+	ba := b - a
+
+	var sum float64
+	for i := 0; i < n; i++ {
+		w := float64(i) * math.Pi / ba
+		// chi, psi 为 e^y 和 1 在 [a, 0] 上的余弦系数
+		chi := (math.Cos(-w*a) - math.Exp(a) + w*math.Sin(-w*a)) / (1 + w*w)
+		psi := -a
+		if i > 0 {
+			psi = math.Sin(-w*a) / w
+		}
+		uk := 2 / ba * (psi - chi)
+		term := real(h.charFunc(complex(w, 0), T, p)*cmplx.Exp(complex(0, w*(x-a)))) * uk
+		if i == 0 {
+			term /= 2
+		}
+		sum += term
+	}
+	return math.Max(math.Exp(k)*sum, 0)
+}
+
+// 看涨期权价格, 由平价关系得到: C - P = F - X
+func (h *Heston) CallPrice(k, T float64, p *HestonParams) float64 {
+	return h.PutPrice(k, T, p) + 1 - math.Exp(k)
+}
+
+// 根据参数计算对数行权价格k, 期限T处的隐含波动率, 使用虚值期权价格反推
+// 模型价格超出无套利区间(如深度虚值时价格下溢为0)无法反推时返回NaN
+func (h *Heston) GetImVol(k, T float64, p *HestonParams) float64 {
+	bsm := blackscholes.BSM{D: "p", S: 1, X: math.Exp(k), T: T}
+	if k >= 0 {
+		bsm.D = "c"
+		bsm.Op = h.CallPrice(k, T, p)
+	} else {
+		bsm.Op = h.PutPrice(k, T, p)
+	}
+	res, err := blackscholes.RationalSolver{}.ImVol(&bsm)
+	if err != nil {
+		return math.NaN()
+	}
+	return res.Iv
+}
+
+// 根据各期限平值附近的方差估计初始参数
+func (h *Heston) InitParams(expiryDataList []*ExpiryData) {
+	h.ExpiryDataList = expiryDataList
+	sorted := make([]*ExpiryData, len(expiryDataList))
+	copy(sorted, expiryDataList)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].T < sorted[j].T })
+
+	h.HestonParams = &HestonParams{Kappa: 1.5, Sigma: 0.5, Rho: -0.5}
+	if len(sorted) == 0 {
+		return
+	}
+	first, last := sorted[0], sorted[len(sorted)-1]
+	h.V0 = atmVariance(first) / first.T
+	h.Theta = atmVariance(last) / last.T
+	// 右侧波动率高于左侧时为正相关
+	list := sorted[0].MarketDataList
+	if len(list) > 1 && list[len(list)-1].V > list[0].V {
+		h.Rho = 0.5
+	}
+}
+
+// 对所有期限的隐含波动率做最小二乘拟合, 返回参数
+func (h *Heston) FitVol() *HestonParams {
+	if h.HestonParams == nil {
+		return nil
+	}
+	residual := func(x []float64) []float64 {
+		p := &HestonParams{V0: x[0], Kappa: x[1], Theta: x[2], Sigma: x[3], Rho: x[4]}
+		r := make([]float64, 0)
+		for _, e := range h.ExpiryDataList {
+			for _, md := range e.MarketDataList {
+				iv := h.GetImVol(md.K, e.T, p)
+				if math.IsNaN(iv) {
+					// 无法反推时按波动率0计入残差, 保持Jacobian有限
+					iv = 0
+				}
+				r = append(r, math.Sqrt(md.weight())*(iv-math.Sqrt(md.V)))
+			}
+		}
+		return r
+	}
+	p := h.HestonParams
+	res := lmSolve(residual,
+		[]float64{p.V0, p.Kappa, p.Theta, p.Sigma, p.Rho},
+		[]float64{1e-6, 1e-4, 1e-6, 1e-4, -0.999},
+		[]float64{10, 50, 10, 10, 0.999},
+		HestonMaxIterations)
+	h.HestonParams = &HestonParams{V0: res.P[0], Kappa: res.P[1], Theta: res.P[2], Sigma: res.P[3], Rho: res.P[4]}
+	return h.HestonParams
+}
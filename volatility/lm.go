@@ -0,0 +1,121 @@
+package volatility
+
+import (
+	"math"
+
+	"gonum.org/v1/gonum/floats"
+	"gonum.org/v1/gonum/mat"
+)
+
+// 通用 Levenberg-Marquardt 的结果
+type lmResult struct {
+	P           []float64 // 拟合参数
+	Iterations  int       // 迭代次数
+	Residual    float64   // 残差平方和开方
+	SolveFailed bool      // 迭代中正规方程求解失败
+}
+
+// 通用 Levenberg-Marquardt 最小二乘, 供没有解析梯度的模型使用
+// residual(p) 返回各数据点的残差, Jacobian由中心差分计算, 每步后把参数截断到 [lower, upper] 内
+// 阻尼的更新方式与 LMFit 一致, 仅在参数更新后判断收敛, 残差下降量小于 Tolerance*max(残差, 1) 时终止
+func lmSolve(residual func(p []float64) []float64, pStart, lower, upper []float64, maxIterations int) *lmResult {
+	n := len(pStart)
+	p := make([]float64, n)
+	copy(p, pStart)
+	clamp(p, lower, upper)
+
+	r := residual(p)
+	m := len(r)
+	res1 := math.Sqrt(floats.Dot(r, r))
+	nu := float64(Nu0)
+	result := &lmResult{}
+	jac := mat.NewDense(m, n, nil)
+	updated := true
+	for i := 0; i < maxIterations; i++ {
+		result.Iterations = i + 1
+		// 参数未更新时沿用上一次的Jacobian
+		if updated {
+			lmJacobian(residual, p, lower, upper, jac)
+		}
+
+		// (J'J)(1+1/nu) dp = -J'r
+		alpha := &mat.Dense{}
+		alpha.Mul(jac.T(), jac)
+		for j := 0; j < n; j++ {
+			alpha.Set(j, j, alpha.At(j, j)*(1+1/nu))
+		}
+		beta := &mat.VecDense{}
+		beta.MulVec(jac.T(), mat.NewVecDense(m, r))
+		beta.ScaleVec(-1, beta)
+
+		dp := &mat.VecDense{}
+		if err := dp.SolveVec(alpha, beta); err != nil {
+			result.SolveFailed = true
+			updated = false
+			nu = nu / 10
+			continue
+		}
+
+		pNew := make([]float64, n)
+		for j := range pNew {
+			pNew[j] = p[j] + dp.AtVec(j)
+		}
+		clamp(pNew, lower, upper)
+		rNew := residual(pNew)
+		res := math.Sqrt(floats.Dot(rNew, rNew))
+
+		updated = !math.IsNaN(res) && res < res1
+		if !updated {
+			// 阻尼已足够大仍无法下降, 视为收敛
+			if nu < 1e-10 {
+				break
+			}
+			nu = nu / 10
+			continue
+		}
+		nu = nu * 10
+		improvement := res1 - res
+		p, r, res1 = pNew, rNew, res
+		if improvement < Tolerance*math.Max(res1, 1) {
+			break
+		}
+	}
+	result.P = p
+	result.Residual = res1
+	return result
+}
+
+// 中心差分计算Jacobian, 靠近边界时使用单侧差分
+func lmJacobian(residual func(p []float64) []float64, p, lower, upper []float64, jac *mat.Dense) {
+	n := len(p)
+	pp := make([]float64, n)
+	for j := 0; j < n; j++ {
+		h := 1e-6 * math.Max(math.Abs(p[j]), 1e-2)
+		up, down := p[j]+h, p[j]-h
+		if upper != nil && up > upper[j] {
+			up = p[j]
+		}
+		if lower != nil && down < lower[j] {
+			down = p[j]
+		}
+		copy(pp, p)
+		pp[j] = up
+		rUp := residual(pp)
+		pp[j] = down
+		rDown := residual(pp)
+		for i := range rUp {
+			jac.Set(i, j, (rUp[i]-rDown[i])/(up-down))
+		}
+	}
+}
+
+func clamp(p, lower, upper []float64) {
+	for j := range p {
+		if lower != nil && p[j] < lower[j] {
+			p[j] = lower[j]
+		}
+		if upper != nil && p[j] > upper[j] {
+			p[j] = upper[j]
+		}
+	}
+}
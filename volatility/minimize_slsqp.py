@@ -47,42 +47,51 @@ def constraint5(params, k):
 
 
 # Objective function to optimize
-def least_squares(params, k, tot_implied_variance):
-    residual = total_variance_pk(params, k) - tot_implied_variance
+def least_squares(params, k, tot_implied_variance, weights):
+    residual = np.sqrt(weights) * (total_variance_pk(params, k) - tot_implied_variance)
     return np.linalg.norm(residual, 2)
 
 
 k_list = []
 v_list = []
+w_list = []
 
 
 def receive_opts():
-    global k_list, v_list
+    global k_list, v_list, w_list
     argv = sys.argv[1:]
     try:
-        opts, args = getopt.getopt(argv, "hk:v:", ["k_list=", "v_list="])
+        opts, args = getopt.getopt(argv, "hk:v:w:", ["k_list=", "v_list=", "w_list="])
     except getopt.GetoptError:
-        print('main.py -k <k_list> -v <v_list>')
+        print('main.py -k <k_list> -v <v_list> [-w <w_list>]')
         sys.exit(2)
     for opt, arg in opts:
         if opt == '-h':
-            print('main.py -k <k_list> -v <v_list>')
+            print('main.py -k <k_list> -v <v_list> [-w <w_list>]')
             sys.exit()
         elif opt in ("-k", "--k_list"):
             k_list = eval(arg)
         elif opt in ("-v", "--v_list"):
             v_list = eval(arg)
+        elif opt in ("-w", "--w_list"):
+            w_list = eval(arg)
     if len(k_list) == 0 or len(v_list) == 0:
-        print('main.py -k <k_list> -v <v_list>')
+        print('main.py -k <k_list> -v <v_list> [-w <w_list>]')
         sys.exit(2)
     if len(k_list) != len(v_list):
         print('len(k_list) must eq len(v_list)')
         sys.exit(2)
+    if len(w_list) == 0:
+        w_list = [1] * len(k_list)
+    if len(w_list) != len(k_list):
+        print('len(w_list) must eq len(k_list)')
+        sys.exit(2)
 
 
 def minimize_slsqp():
     mkt_k = np.transpose(np.array(k_list))
     mkt_tot_variance = np.transpose(np.array(v_list))
+    mkt_weights = np.transpose(np.array(w_list))
 
     # ===========  TotalVariance’s Parameters Boundaries ======================================
     a_low = 0.000001
@@ -112,7 +121,7 @@ def minimize_slsqp():
     cons4 = {'type': 'ineq', 'fun': lambda x: constraint4(x, mkt_k)}
     cons5 = {'type': 'ineq', 'fun': lambda x: constraint5(x, mkt_k)}
 
-    result = minimize(lambda x: least_squares(x, mkt_k, mkt_tot_variance),
+    result = minimize(lambda x: least_squares(x, mkt_k, mkt_tot_variance, mkt_weights),
                       params_init, method='SLSQP',
                       bounds=bounds,
                       constraints=[cons1, cons2, cons3, cons4, cons5],
@@ -122,6 +131,7 @@ def minimize_slsqp():
 
 
 # python3 minimize_slsqp.py -k '[-0.1524,-0.0879,-0.0273,0.0299,0.0839,0.1352,0.2530]' -v '[0.01018,0.00820,0.00720,0.00597,0.00663,0.00568,0.01289]'
+# optional weights: -w '[1,1,2,4,2,1,1]'
 if __name__ == "__main__":
     receive_opts()
     minimize_slsqp()
@@ -0,0 +1,195 @@
+package volatility
+
+import (
+	"math"
+
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/optimize"
+)
+
+const (
+	FitModeLM            = ""               // Levenberg-Marquardt, 见 LMFit
+	FitModeQuasiExplicit = "quasi-explicit" // Zeliade 准显式拟合, 见 QuasiExplicitFit
+
+	QuasiExplicitGrid = 11 // 外层优化前在 (Eta, C) 上搜索初值的网格点数
+)
+
+var (
+	DefaultRhoBound = [2]float64{-0.999, 0.999} // 准显式拟合时 Rho 的默认上下界
+	DefaultCBound   = [2]float64{0.005, 1}      // 准显式拟合时 C 的默认上下界
+)
+
+// 准显式拟合的内层问题: 固定 Eta=m, C=σ, 令 y=(k-m)/σ, 总方差 w = a + d*y + c*sqrt(y^2+1) 对 (a, d, c) 是线性的,
+// 约束 0<=c<=4σ, RhoBound[0]*c<=d<=RhoBound[1]*c, |d|<=4σ-c, 0<=a<=max(w) 构成多面体
+type quasiExplicitInner struct {
+	ks, ws   []float64
+	weights  []float64
+	wMax     float64
+	rhoBound [2]float64
+}
+
+// 依次把至多3个约束作为等式求解, 取满足全部约束的最优解
+// 目标函数是凸的, 最优解必然是某个活动约束集合上的等式约束最小二乘解
+func (q *quasiExplicitInner) solve(m, sigma float64) (x [3]float64, obj float64) {
+	normal := mat.NewDense(3, 3, nil)
+	rhs := make([]float64, 3)
+	for i, k := range q.ks {
+		y := (k - m) / sigma
+		row := []float64{1, y, math.Sqrt(y*y + 1)}
+		for r := 0; r < 3; r++ {
+			for c := 0; c < 3; c++ {
+				normal.Set(r, c, normal.At(r, c)+q.weights[i]*row[r]*row[c])
+			}
+			rhs[r] += q.weights[i] * row[r] * q.ws[i]
+		}
+	}
+	// G x <= h, x = [a, d, c]
+	g := [][3]float64{
+		{0, 0, -1},
+		{0, 0, 1},
+		{0, 1, -q.rhoBound[1]},
+		{0, -1, q.rhoBound[0]},
+		{0, 1, 1},
+		{0, -1, 1},
+		{-1, 0, 0},
+		{1, 0, 0},
+	}
+	h := []float64{0, 4 * sigma, 0, 0, 4 * sigma, 4 * sigma, 0, q.wMax}
+
+	obj = math.Inf(1)
+	for mask := 0; mask < 1<<len(g); mask++ {
+		active := make([]int, 0, 3)
+		for j := range g {
+			if mask&(1<<j) != 0 {
+				active = append(active, j)
+			}
+		}
+		if len(active) > 3 {
+			continue
+		}
+		n := 3 + len(active)
+		kkt := mat.NewDense(n, n, nil)
+		b := mat.NewVecDense(n, nil)
+		kkt.Slice(0, 3, 0, 3).(*mat.Dense).Copy(normal)
+		for r := 0; r < 3; r++ {
+			b.SetVec(r, rhs[r])
+		}
+		for i, j := range active {
+			for c := 0; c < 3; c++ {
+				kkt.Set(3+i, c, g[j][c])
+				kkt.Set(c, 3+i, g[j][c])
+			}
+			b.SetVec(3+i, h[j])
+		}
+		var sol mat.VecDense
+		if err := sol.SolveVec(kkt, b); err != nil {
+			if _, ok := err.(mat.Condition); !ok {
+				continue
+			}
+		}
+		cand := [3]float64{sol.AtVec(0), sol.AtVec(1), sol.AtVec(2)}
+		if !q.feasible(cand, g, h) {
+			continue
+		}
+		if v := q.objective(m, sigma, cand); v < obj {
+			x, obj = cand, v
+		}
+	}
+	return x, obj
+}
+
+func (q *quasiExplicitInner) feasible(x [3]float64, g [][3]float64, h []float64) bool {
+	for j := range g {
+		v := g[j][0]*x[0] + g[j][1]*x[1] + g[j][2]*x[2]
+		if math.IsNaN(v) || v > h[j]+1e-12*math.Max(1, math.Abs(h[j])) {
+			return false
+		}
+	}
+	return true
+}
+
+func (q *quasiExplicitInner) objective(m, sigma float64, x [3]float64) float64 {
+	sum := 0.0
+	for i, k := range q.ks {
+		y := (k - m) / sigma
+		r := x[0] + x[1]*y + x[2]*math.Sqrt(y*y+1) - q.ws[i]
+		sum += q.weights[i] * r * r
+	}
+	return sum
+}
+
+func (s *Volatility) rhoBound() [2]float64 {
+	if s.RhoBound == [2]float64{} {
+		return DefaultRhoBound
+	}
+	return s.RhoBound
+}
+
+func (s *Volatility) cBound() [2]float64 {
+	if s.CBound == [2]float64{} {
+		return DefaultCBound
+	}
+	return s.CBound
+}
+
+// Zeliade 准显式拟合, 外层对 (Eta, C) 做 Nelder-Mead, 内层对 (a, d, c) 做带约束的线性最小二乘, 拟合总方差
+// 不依赖 InitParams 的初值, Rho 和 C 分别限制在 RhoBound, CBound 内
+// see: Zeliade Systems, Quasi-explicit calibration of Gatheral's SVI model
+func (s *Volatility) QuasiExplicitFit(marketDataList []*MarketData) *Params {
+	return s.quasiExplicitFit(marketDataList, &FitReport{})
+}
+
+// 外层 Nelder-Mead 的迭代次数和终止原因记录在 report 中
+func (s *Volatility) quasiExplicitFit(marketDataList []*MarketData, report *FitReport) *Params {
+	q := &quasiExplicitInner{rhoBound: s.rhoBound()}
+	kMin, kMax := math.Inf(1), math.Inf(-1)
+	for _, md := range marketDataList {
+		w := md.V * s.T
+		q.ks, q.ws, q.weights = append(q.ks, md.K), append(q.ws, w), append(q.weights, md.weight())
+		q.wMax = math.Max(q.wMax, w)
+		kMin, kMax = math.Min(kMin, md.K), math.Max(kMax, md.K)
+	}
+	cBound := s.cBound()
+	lower := []float64{math.Min(2*kMin, 2*kMax), cBound[0]}
+	upper := []float64{math.Max(2*kMin, 2*kMax), cBound[1]}
+	toX, toY := boxTransform(lower, upper)
+	outer := func(y []float64) float64 {
+		x := toX(y)
+		_, obj := q.solve(x[0], x[1])
+		return obj
+	}
+
+	// 网格搜索外层初值, C 按对数等距
+	best, bestObj := []float64{0, cBound[0]}, math.Inf(1)
+	for i := 0; i < QuasiExplicitGrid; i++ {
+		m := lower[0] + (upper[0]-lower[0])*float64(i)/float64(QuasiExplicitGrid-1)
+		for j := 0; j < QuasiExplicitGrid; j++ {
+			sigma := cBound[0] * math.Pow(cBound[1]/cBound[0], float64(j)/float64(QuasiExplicitGrid-1))
+			if _, obj := q.solve(m, sigma); obj < bestObj {
+				best, bestObj = []float64{m, sigma}, obj
+			}
+		}
+	}
+	y := toY(best)
+	report.Termination = TerminationMaxIterations
+	result, err := optimize.Minimize(optimize.Problem{Func: outer}, y, nil, &optimize.NelderMead{})
+	if result != nil {
+		report.Iterations = result.Stats.MajorIterations
+		if err == nil {
+			report.Termination = TerminationConverged
+		}
+		if result.F <= bestObj {
+			y = result.X
+		}
+	}
+
+	x := toX(y)
+	m, sigma := x[0], x[1]
+	inner, _ := q.solve(m, sigma)
+	p := &Params{A: inner[0], C: sigma, Eta: m}
+	if inner[2] > 0 {
+		p.B = inner[2] / sigma
+		p.Rho = inner[1] / inner[2]
+	}
+	return p
+}
@@ -0,0 +1,65 @@
+package volatility
+
+import (
+	"math"
+
+	"github.com/charlerive/library/blackscholes"
+	"gonum.org/v1/gonum/mat"
+)
+
+const (
+	TerminationConverged          = "converged"           // 残差变化小于容差
+	TerminationMaxIterations      = "max_iterations"      // 达到最大迭代次数
+	TerminationNotFitted          = "not_fitted"          // 数据不足或没有初值, 未拟合
+	TerminationButterflyArbitrage = "butterfly_arbitrage" // 拟合结果存在蝶式套利, 被 ArbitrageReject 拒绝或 ArbitrageRepair 无法修复
+)
+
+// FitVol 的拟合报告
+type FitReport struct {
+	Residuals       []float64 `json:"residuals"`        // 各点隐含波动率残差, 模型减市场
+	PriceResiduals  []float64 `json:"price_residuals"`  // 各点虚值期权价格残差, 远期为1且不折现
+	RMSE            float64   `json:"rmse"`             // 隐含波动率残差的均方根
+	MaxResidual     float64   `json:"max_residual"`     // 隐含波动率残差绝对值的最大值
+	Iterations      int       `json:"iterations"`       // 迭代次数
+	Termination     string    `json:"termination"`      // 终止原因
+	SolveFailed     bool      `json:"solve_failed"`     // 迭代中正规方程求解失败
+	ConditionNumber float64   `json:"condition_number"` // 拟合参数处加权正规矩阵 J'WJ 的条件数
+}
+
+// 计算拟合参数 p 在 MarketDataList 上的残差和正规矩阵的条件数
+func (s *Volatility) residualReport(p *Params, report *FitReport) {
+	n := len(s.MarketDataList)
+	if n == 0 {
+		return
+	}
+	report.Residuals = make([]float64, n)
+	report.PriceResiduals = make([]float64, n)
+	x := mat.NewVecDense(n, nil)
+	sum := 0.0
+	for i, md := range s.MarketDataList {
+		x.SetVec(i, md.K)
+		iv, market := s.GetImVol(md.K, p), math.Sqrt(md.V)
+		b76 := blackscholes.B76{D: "p", F: 1, X: math.Exp(md.K), T: s.T}
+		if md.K >= 0 {
+			b76.D = "c"
+		}
+		r := iv - market
+		report.Residuals[i] = r
+		report.PriceResiduals[i] = b76.GetOptionPriceFromIv(iv) - b76.GetOptionPriceFromIv(market)
+		report.MaxResidual = math.Max(report.MaxResidual, math.Abs(r))
+		sum += r * r
+	}
+	report.RMSE = math.Sqrt(sum / float64(n))
+
+	jac := s.GradFMatrix(x, p)
+	sw := s.sqrtWeights(n)
+	for i := 0; i < n; i++ {
+		row := jac.RawRowView(i)
+		for j := range row {
+			row[j] *= sw[i]
+		}
+	}
+	normal := &mat.Dense{}
+	normal.Mul(jac.T(), jac)
+	report.ConditionNumber = mat.Cond(normal, 2)
+}
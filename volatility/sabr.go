@@ -0,0 +1,138 @@
+package volatility
+
+import (
+	"math"
+)
+
+const SabrMaxIterations = 100
+
+type SabrParams struct {
+	Alpha float64 // 初始波动率水平
+	Beta  float64 // CEV指数, 0为正态, 1为对数正态
+	Rho   float64 // 标的与波动率的相关系数
+	Nu    float64 // 波动率的波动率
+}
+
+func (p *SabrParams) Copy() *SabrParams {
+	return &SabrParams{
+		Alpha: p.Alpha,
+		Beta:  p.Beta,
+		Rho:   p.Rho,
+		Nu:    p.Nu,
+	}
+}
+
+// SABR 模型, 隐含波动率采用 Hagan 渐近展开
+// Normal 为 true 时使用正态展开, 波动率与 MarketData.V 均为正态(Bachelier)波动率
+// see: Hagan et al., Managing Smile Risk
+type Sabr struct {
+	*SabrParams
+	MarketDataList []*MarketData
+	F              float64 // 远期价格
+	T              float64 // （期权到期日-当前时间）/365天
+	Normal         bool    // 是否使用正态展开
+	FitBeta        bool    // 是否拟合beta, 否则固定为 SabrParams.Beta
+}
+
+func NewSabr(F float64, T float64, beta float64) *Sabr {
+	return &Sabr{
+		SabrParams: &SabrParams{Beta: beta},
+		F:          F,
+		T:          T,
+	}
+}
+
+// 根据参数和对数行权价格 k=ln(X/F) 计算隐含波动率
+func (s *Sabr) GetImVol(k float64, p *SabrParams) float64 {
+	if s.Normal {
+		return HaganNormalVol(s.F, s.F*math.Exp(k), s.T, p)
+	}
+	return HaganLognormalVol(s.F, s.F*math.Exp(k), s.T, p)
+}
+
+// z/x(z), z趋于0时为1
+func sabrZx(z, rho float64) float64 {
+	if math.Abs(z) < 1e-8 {
+		return 1 - rho*z/2
+	}
+	x := math.Log((math.Sqrt(1-2*rho*z+z*z) + z - rho) / (1 - rho))
+	return z / x
+}
+
+// Hagan 对数正态(Black)波动率展开
+func HaganLognormalVol(F, X, T float64, p *SabrParams) float64 {
+	b1 := 1 - p.Beta
+	lfk := math.Log(F / X)
+	fkb := math.Pow(F*X, b1/2)
+	z := p.Nu / p.Alpha * fkb * lfk
+	denom := fkb * (1 + b1*b1/24*lfk*lfk + b1*b1*b1*b1/1920*lfk*lfk*lfk*lfk)
+	corr := 1 + (b1*b1/24*p.Alpha*p.Alpha/(fkb*fkb)+p.Rho*p.Beta*p.Nu*p.Alpha/(4*fkb)+(2-3*p.Rho*p.Rho)/24*p.Nu*p.Nu)*T
+	return p.Alpha / denom * sabrZx(z, p.Rho) * corr
+}
+
+// Hagan 正态(Bachelier)波动率展开
+func HaganNormalVol(F, X, T float64, p *SabrParams) float64 {
+	b1 := 1 - p.Beta
+	lfk := math.Log(F / X)
+	fkb := math.Pow(F*X, b1/2)
+	z := p.Nu / p.Alpha * fkb * lfk
+	num := 1 + lfk*lfk/24 + lfk*lfk*lfk*lfk/1920
+	denom := 1 + b1*b1/24*lfk*lfk + b1*b1*b1*b1/1920*lfk*lfk*lfk*lfk
+	corr := 1 + (-p.Beta*(2-p.Beta)/24*p.Alpha*p.Alpha/(fkb*fkb)+p.Rho*p.Beta*p.Nu*p.Alpha/(4*fkb)+(2-3*p.Rho*p.Rho)/24*p.Nu*p.Nu)*T
+	return p.Alpha * math.Pow(F*X, p.Beta/2) * num / denom * sabrZx(z, p.Rho) * corr
+}
+
+// 根据平值附近的波动率估计初始参数, beta保持不变
+func (s *Sabr) InitParams(marketDataList []*MarketData) {
+	s.MarketDataList = marketDataList
+	beta := 0.0
+	if s.SabrParams != nil {
+		beta = s.Beta
+	}
+	atm, minK := 0.0, math.Inf(1)
+	for _, md := range marketDataList {
+		if math.Abs(md.K) < minK {
+			atm, minK = math.Sqrt(md.V), math.Abs(md.K)
+		}
+	}
+	s.SabrParams = &SabrParams{Beta: beta, Nu: 1}
+	if s.Normal {
+		s.Alpha = atm / math.Pow(s.F, beta)
+	} else {
+		s.Alpha = atm * math.Pow(s.F, 1-beta)
+	}
+}
+
+// 曲线拟合返回参数, FitBeta为false时beta固定
+func (s *Sabr) FitVol() *SabrParams {
+	if s.SabrParams == nil || s.Alpha == 0 {
+		return s.SabrParams
+	}
+	// 拟合 alpha*F^(beta-1) 而不是 alpha, 使其与beta解耦, 量级约为平值波动率
+	beta := s.Beta
+	toParams := func(x []float64) *SabrParams {
+		p := &SabrParams{Beta: beta, Rho: x[1], Nu: x[2]}
+		if len(x) > 3 {
+			p.Beta = x[3]
+		}
+		p.Alpha = x[0] * math.Pow(s.F, 1-p.Beta)
+		return p
+	}
+	residual := func(x []float64) []float64 {
+		p := toParams(x)
+		r := make([]float64, len(s.MarketDataList))
+		for i, md := range s.MarketDataList {
+			r[i] = math.Sqrt(md.weight()) * (s.GetImVol(md.K, p) - math.Sqrt(md.V))
+		}
+		return r
+	}
+	pStart := []float64{s.Alpha * math.Pow(s.F, beta-1), s.Rho, s.Nu}
+	lower := []float64{1e-8, -0.999, 1e-4}
+	upper := []float64{math.Inf(1), 0.999, 20}
+	if s.FitBeta {
+		pStart, lower, upper = append(pStart, beta), append(lower, 0), append(upper, 1)
+	}
+	res := lmSolve(residual, pStart, lower, upper, SabrMaxIterations)
+	s.SabrParams = toParams(res.P)
+	return s.SabrParams
+}
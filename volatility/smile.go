@@ -0,0 +1,117 @@
+package volatility
+
+import (
+	"errors"
+	"math"
+)
+
+var ErrNotEnoughData = errors.New("volatility: not enough market data")
+
+// 市场数据无法给出初值(如总方差全部相同)时未拟合
+var ErrNotFitted = errors.New("volatility: smile was not fitted")
+
+// 单个期限的波动率微笑模型, k = ln(X/F), 参数为模型当前(拟合后)的参数
+// 调用方只依赖该接口即可在 SVI, SVI-JW, SSVI, SABR 之间切换
+type SmileModel interface {
+	TotalVariance(k float64) float64        // 总方差 w(k) = iv*iv*T
+	ImVol(k float64) float64                // 隐含波动率
+	ParamsGrad(k float64) []float64         // 隐含波动率对模型参数的梯度
+	Fit(marketDataList []*MarketData) error // 拟合市场数据并更新模型参数
+}
+
+var (
+	_ SmileModel = (*Volatility)(nil)
+	_ SmileModel = (*Sabr)(nil)
+)
+
+// 把行权价格空间的市场数据转换为对数行权价格空间
+func MarketDataFromStrikes(forwardPrice float64, marketDataList []*MarketDataOld) []*MarketData {
+	list := make([]*MarketData, 0, len(marketDataList))
+	for _, md := range marketDataList {
+		list = append(list, &MarketData{
+			K: math.Log(md.StrikePrice / forwardPrice),
+			V: md.ImVol * md.ImVol,
+		})
+	}
+	return list
+}
+
+// 中心差分梯度
+func numericGrad(f func(x []float64) float64, x []float64) []float64 {
+	grad := make([]float64, len(x))
+	xx := make([]float64, len(x))
+	for j := range x {
+		h := 1e-6 * math.Max(math.Abs(x[j]), 1e-2)
+		copy(xx, x)
+		xx[j] = x[j] + h
+		up := f(xx)
+		xx[j] = x[j] - h
+		grad[j] = (up - f(xx)) / (2 * h)
+	}
+	return grad
+}
+
+func (s *Volatility) TotalVariance(k float64) float64 {
+	iv := s.ImVol(k)
+	return iv * iv * s.T
+}
+
+func (s *Volatility) ImVol(k float64) float64 {
+	return s.GetImVol(k, s.Params)
+}
+
+// 对 A, B, C, Rho, Eta 的梯度
+func (s *Volatility) ParamsGrad(k float64) []float64 {
+	return s.GradF(k, s.Params)
+}
+
+func (s *Volatility) Fit(marketDataList []*MarketData) error {
+	if len(marketDataList) < ParamsLen {
+		return ErrNotEnoughData
+	}
+	// InitParams 会覆盖 s.Params, 未拟合或拟合被拒绝时恢复拟合前的参数
+	prev := s.Params
+	s.InitParams(marketDataList)
+	p, report := s.FitVol()
+	switch report.Termination {
+	case TerminationNotFitted:
+		s.Params = prev
+		return ErrNotFitted
+	case TerminationButterflyArbitrage:
+		s.Params = prev
+		return ErrButterflyArbitrage
+	}
+	s.Params = p
+	return nil
+}
+
+// 正态展开时为正态波动率的总方差
+func (s *Sabr) TotalVariance(k float64) float64 {
+	iv := s.ImVol(k)
+	return iv * iv * s.T
+}
+
+func (s *Sabr) ImVol(k float64) float64 {
+	return s.GetImVol(k, s.SabrParams)
+}
+
+// 对 Alpha, Beta, Rho, Nu 的梯度
+func (s *Sabr) ParamsGrad(k float64) []float64 {
+	p := s.SabrParams
+	return numericGrad(func(x []float64) float64 {
+		return s.GetImVol(k, &SabrParams{Alpha: x[0], Beta: x[1], Rho: x[2], Nu: x[3]})
+	}, []float64{p.Alpha, p.Beta, p.Rho, p.Nu})
+}
+
+func (s *Sabr) Fit(marketDataList []*MarketData) error {
+	n := 3
+	if s.FitBeta {
+		n = 4
+	}
+	if len(marketDataList) < n {
+		return ErrNotEnoughData
+	}
+	s.InitParams(marketDataList)
+	s.FitVol()
+	return nil
+}
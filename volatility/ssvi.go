@@ -0,0 +1,218 @@
+package volatility
+
+import (
+	"math"
+	"sort"
+)
+
+const SsviMaxIterations = 100
+
+// SSVI 曲面参数, phi 使用 power-law 形式 phi(θ) = η / (θ^γ (1+θ)^(1-γ))
+// η(1+|ρ|)<=2, γ∈[0, 1/2] 时无蝶式套利, θ随期限递增时无日历套利
+// see: Gatheral & Jacquier, Arbitrage-free SVI volatility surfaces
+type SsviParams struct {
+	Rho    float64   // 旋转
+	Eta    float64   // 曲率水平
+	Gamma  float64   // 曲率随平值总方差的衰减
+	Thetas []float64 // 各期限的平值总方差, 随期限递增
+}
+
+func (p *SsviParams) Copy() *SsviParams {
+	thetas := make([]float64, len(p.Thetas))
+	copy(thetas, p.Thetas)
+	return &SsviParams{
+		Rho:    p.Rho,
+		Eta:    p.Eta,
+		Gamma:  p.Gamma,
+		Thetas: thetas,
+	}
+}
+
+func ssviPhi(theta, eta, gamma float64) float64 {
+	return eta / (math.Pow(theta, gamma) * math.Pow(1+theta, 1-gamma))
+}
+
+// SSVI 总方差 w(k) = θ/2 * (1 + ρφk + sqrt((φk+ρ)^2 + 1-ρ^2))
+func SsviVariance(k, theta, rho, eta, gamma float64) float64 {
+	phi := ssviPhi(theta, eta, gamma)
+	return theta / 2 * (1 + rho*phi*k + math.Sqrt((phi*k+rho)*(phi*k+rho)+1-rho*rho))
+}
+
+// 多期限的 SSVI 波动率曲面, 所有期限联合拟合
+type Ssvi struct {
+	*SsviParams
+	ExpiryDataList []*ExpiryData // 按期限升序
+	Ts             []float64     // Thetas 对应的期限
+}
+
+func NewSsvi() *Ssvi {
+	return &Ssvi{}
+}
+
+// 期限T的平值总方差, 期限之间线性插值, 第一个期限之前按 θ1*T/T1,
+// 最后一个期限之后沿最后一段斜率外推, 保持θ递增
+func (s *Ssvi) Theta(T float64) float64 {
+	n := len(s.Ts)
+	if n == 0 || T <= 0 {
+		return 0
+	}
+	if T <= s.Ts[0] {
+		return s.Thetas[0] * T / s.Ts[0]
+	}
+	i := sort.SearchFloat64s(s.Ts, T)
+	if i == n {
+		i = n - 1
+	}
+	t0, th0 := 0.0, 0.0
+	if i > 0 {
+		t0, th0 = s.Ts[i-1], s.Thetas[i-1]
+	}
+	return th0 + (s.Thetas[i]-th0)*(T-t0)/(s.Ts[i]-t0)
+}
+
+func (s *Ssvi) TotalVariance(k, T float64) float64 {
+	theta := s.Theta(T)
+	if theta <= 0 {
+		return 0
+	}
+	return SsviVariance(k, theta, s.Rho, s.Eta, s.Gamma)
+}
+
+// 任意期限T, 对数行权价格k处的隐含波动率
+func (s *Ssvi) ImVol(k, T float64) float64 {
+	if T <= 0 {
+		return 0
+	}
+	return math.Sqrt(s.TotalVariance(k, T) / T)
+}
+
+// 期限T处的单期限切片
+func (s *Ssvi) Slice(T float64) *SsviSlice {
+	return &SsviSlice{
+		Theta: s.Theta(T),
+		Rho:   s.Rho,
+		Eta:   s.Eta,
+		Gamma: s.Gamma,
+		T:     T,
+	}
+}
+
+// 平值附近的总方差
+func atmVariance(e *ExpiryData) float64 {
+	v, minK := 0.0, math.Inf(1)
+	for _, md := range e.MarketDataList {
+		if math.Abs(md.K) < minK {
+			v, minK = md.V, math.Abs(md.K)
+		}
+	}
+	return v * e.T
+}
+
+// 根据各期限平值方差估计初始参数
+func (s *Ssvi) InitParams(expiryDataList []*ExpiryData) {
+	s.ExpiryDataList = make([]*ExpiryData, len(expiryDataList))
+	copy(s.ExpiryDataList, expiryDataList)
+	sort.Slice(s.ExpiryDataList, func(i, j int) bool { return s.ExpiryDataList[i].T < s.ExpiryDataList[j].T })
+
+	s.SsviParams = &SsviParams{Rho: -0.3, Eta: 1, Gamma: 0.25}
+	s.Ts = make([]float64, 0, len(expiryDataList))
+	prev := 0.0
+	for _, e := range s.ExpiryDataList {
+		theta := math.Max(atmVariance(e), prev*(1+1e-6))
+		s.Ts = append(s.Ts, e.T)
+		s.Thetas = append(s.Thetas, theta)
+		prev = theta
+	}
+}
+
+// 联合拟合所有期限, 参数化为 x = [ρ, u, γ, dθ1, dθ2, ...],
+// 其中 η = 2u/(1+|ρ|), u∈(0,1], θi = dθ1 + ... + dθi, dθ>0
+func (s *Ssvi) FitVol() *SsviParams {
+	if s.SsviParams == nil || len(s.Thetas) == 0 {
+		return s.SsviParams
+	}
+	n := len(s.Thetas)
+	toParams := func(x []float64) *SsviParams {
+		p := &SsviParams{Rho: x[0], Eta: 2 * x[1] / (1 + math.Abs(x[0])), Gamma: x[2], Thetas: make([]float64, n)}
+		sum := 0.0
+		for i := 0; i < n; i++ {
+			sum += x[3+i]
+			p.Thetas[i] = sum
+		}
+		return p
+	}
+	residual := func(x []float64) []float64 {
+		p := toParams(x)
+		r := make([]float64, 0)
+		for i, e := range s.ExpiryDataList {
+			for _, md := range e.MarketDataList {
+				w := SsviVariance(md.K, p.Thetas[i], p.Rho, p.Eta, p.Gamma)
+				r = append(r, math.Sqrt(md.weight())*(math.Sqrt(w/e.T)-math.Sqrt(md.V)))
+			}
+		}
+		return r
+	}
+
+	pStart := []float64{s.Rho, math.Min(s.Eta*(1+math.Abs(s.Rho))/2, 1), s.Gamma}
+	lower := []float64{-0.999, 1e-4, 0}
+	upper := []float64{0.999, 1, 0.5}
+	prev := 0.0
+	for _, theta := range s.Thetas {
+		pStart = append(pStart, theta-prev)
+		lower = append(lower, 1e-10)
+		upper = append(upper, math.Inf(1))
+		prev = theta
+	}
+	res := lmSolve(residual, pStart, lower, upper, SsviMaxIterations)
+	s.SsviParams = toParams(res.P)
+	return s.SsviParams
+}
+
+func (s *Ssvi) Fit(expiryDataList []*ExpiryData) error {
+	count := 0
+	for _, e := range expiryDataList {
+		count += len(e.MarketDataList)
+	}
+	if len(expiryDataList) == 0 || count < 3+len(expiryDataList) {
+		return ErrNotEnoughData
+	}
+	s.InitParams(expiryDataList)
+	s.FitVol()
+	return nil
+}
+
+// SSVI 的单期限切片
+type SsviSlice struct {
+	Theta float64 // 平值总方差
+	Rho   float64
+	Eta   float64
+	Gamma float64
+	T     float64 // （期权到期日-当前时间）/365天
+}
+
+var _ SmileModel = (*SsviSlice)(nil)
+
+func (s *SsviSlice) TotalVariance(k float64) float64 {
+	return SsviVariance(k, s.Theta, s.Rho, s.Eta, s.Gamma)
+}
+
+func (s *SsviSlice) ImVol(k float64) float64 {
+	return math.Sqrt(s.TotalVariance(k) / s.T)
+}
+
+// 对 Theta, Rho, Eta, Gamma 的梯度
+func (s *SsviSlice) ParamsGrad(k float64) []float64 {
+	return numericGrad(func(x []float64) float64 {
+		return math.Sqrt(SsviVariance(k, x[0], x[1], x[2], x[3]) / s.T)
+	}, []float64{s.Theta, s.Rho, s.Eta, s.Gamma})
+}
+
+// 单独拟合该期限, 不影响所属曲面
+func (s *SsviSlice) Fit(marketDataList []*MarketData) error {
+	surface := NewSsvi()
+	if err := surface.Fit([]*ExpiryData{{T: s.T, MarketDataList: marketDataList}}); err != nil {
+		return err
+	}
+	*s = *surface.Slice(s.T)
+	return nil
+}
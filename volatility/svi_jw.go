@@ -0,0 +1,208 @@
+package volatility
+
+import (
+	"errors"
+	"math"
+)
+
+var ErrInvalidJW = errors.New("volatility: invalid svi jump-wings params")
+
+// SVI Jump-Wings 参数, 与期限相关, 更接近交易员的报价习惯
+// see: Gatheral & Jacquier, Arbitrage-free SVI volatility surfaces
+type JWParams struct {
+	V      float64 // 平值方差
+	Psi    float64 // 平值偏斜
+	P      float64 // 左翼(看跌)斜率
+	C      float64 // 右翼(看涨)斜率
+	VTilde float64 // 最小方差
+}
+
+func (jw *JWParams) Copy() *JWParams {
+	return &JWParams{
+		V:      jw.V,
+		Psi:    jw.Psi,
+		P:      jw.P,
+		C:      jw.C,
+		VTilde: jw.VTilde,
+	}
+}
+
+// raw SVI 参数转换为 JW 参数, 平值总方差须为正
+func RawToJW(p *Params, T float64) (*JWParams, error) {
+	sq := math.Sqrt(p.Eta*p.Eta + p.C*p.C)
+	w := p.A + p.B*(-p.Rho*p.Eta+sq)
+	if !(w > 0) || p.B < 0 {
+		return nil, ErrInvalidJW
+	}
+	sw := math.Sqrt(w)
+	jw := &JWParams{
+		V:      w / T,
+		P:      p.B * (1 - p.Rho) / sw,
+		C:      p.B * (1 + p.Rho) / sw,
+		VTilde: (p.A + p.B*p.C*math.Sqrt(1-p.Rho*p.Rho)) / T,
+	}
+	if sq > 0 {
+		jw.Psi = p.B / (2 * sw) * (p.Rho - p.Eta/sq)
+	} else {
+		jw.Psi = p.B / (2 * sw) * p.Rho
+	}
+	return jw, nil
+}
+
+// JW 参数转换为 raw SVI 参数
+// Eta=0 且 Rho=0 时 C 无法由 JW 参数确定, 返回 ErrInvalidJW
+func JWToRaw(jw *JWParams, T float64) (*Params, error) {
+	w := jw.V * T
+	if !(w > 0) || jw.P < 0 || jw.C < 0 || jw.P+jw.C == 0 {
+		return nil, ErrInvalidJW
+	}
+	sw := math.Sqrt(w)
+	b := sw / 2 * (jw.C + jw.P)
+	rho := 1 - jw.P*sw/b
+	// beta = Eta / sqrt(Eta^2 + C^2)
+	beta := rho - 2*jw.Psi*sw/b
+	if beta < -1 || beta > 1 {
+		return nil, ErrInvalidJW
+	}
+	p := &Params{B: b, Rho: rho}
+	sr := math.Sqrt(1 - rho*rho)
+	if beta == 0 {
+		if rho == 0 {
+			return nil, ErrInvalidJW
+		}
+		p.C = (jw.V - jw.VTilde) * T / (b * (1 - sr))
+	} else {
+		alpha := math.Copysign(math.Sqrt(1/(beta*beta)-1), beta)
+		p.Eta = (jw.V - jw.VTilde) * T / (b * (-rho + math.Copysign(math.Sqrt(1+alpha*alpha), alpha) - alpha*sr))
+		p.C = alpha * p.Eta
+	}
+	if p.C < 0 || math.IsNaN(p.C) {
+		return nil, ErrInvalidJW
+	}
+	p.A = jw.VTilde*T - b*p.C*sr
+	return p, nil
+}
+
+// 在 JW 参数空间拟合和调整的 SVI 曲线, 查询时转换为 raw SVI
+type SviJW struct {
+	*JWParams
+	Fixed          [5]bool // 拟合时保持不变的参数, 顺序为 V, Psi, P, C, VTilde
+	MarketDataList []*MarketData
+	T              float64 // （期权到期日-当前时间）/365天
+	raw            *Volatility
+}
+
+var _ SmileModel = (*SviJW)(nil)
+
+func NewSviJW(T float64) *SviJW {
+	return &SviJW{
+		T:   T,
+		raw: NewVolatility(T),
+	}
+}
+
+// 当前 JW 参数对应的 raw SVI 参数
+func (s *SviJW) Raw() (*Params, error) {
+	if s.JWParams == nil {
+		return nil, ErrInvalidJW
+	}
+	return JWToRaw(s.JWParams, s.T)
+}
+
+// 根据 JW 参数和对数行权价格找到波动率, 参数无效时返回0
+func (s *SviJW) GetImVol(k float64, jw *JWParams) float64 {
+	p, err := JWToRaw(jw, s.T)
+	if err != nil {
+		return 0
+	}
+	return s.raw.GetImVol(k, p)
+}
+
+func (s *SviJW) TotalVariance(k float64) float64 {
+	iv := s.ImVol(k)
+	return iv * iv * s.T
+}
+
+func (s *SviJW) ImVol(k float64) float64 {
+	return s.GetImVol(k, s.JWParams)
+}
+
+// 对 V, Psi, P, C, VTilde 的梯度
+func (s *SviJW) ParamsGrad(k float64) []float64 {
+	return numericGrad(func(x []float64) float64 {
+		return s.GetImVol(k, jwFromSlice(x))
+	}, jwToSlice(s.JWParams))
+}
+
+// 以 raw SVI 拟合结果为初值, 在 JW 参数空间拟合, Fixed 中的参数保持当前值
+func (s *SviJW) Fit(marketDataList []*MarketData) error {
+	if len(marketDataList) < ParamsLen {
+		return ErrNotEnoughData
+	}
+	s.MarketDataList = marketDataList
+	if err := s.raw.Fit(marketDataList); err != nil {
+		return err
+	}
+	start, err := RawToJW(s.raw.Params, s.T)
+	if err != nil {
+		return err
+	}
+	x := jwToSlice(start)
+	if s.JWParams != nil {
+		current := jwToSlice(s.JWParams)
+		for i, fixed := range s.Fixed {
+			if fixed {
+				x[i] = current[i]
+			}
+		}
+	}
+
+	// 只对未固定的参数做最小二乘
+	free := make([]int, 0)
+	for i, fixed := range s.Fixed {
+		if !fixed {
+			free = append(free, i)
+		}
+	}
+	if len(free) == 0 {
+		s.JWParams = jwFromSlice(x)
+		return nil
+	}
+	expand := func(y []float64) []float64 {
+		full := make([]float64, len(x))
+		copy(full, x)
+		for j, i := range free {
+			full[i] = y[j]
+		}
+		return full
+	}
+	residual := func(y []float64) []float64 {
+		jw := jwFromSlice(expand(y))
+		r := make([]float64, len(marketDataList))
+		p, err := JWToRaw(jw, s.T)
+		for i, md := range marketDataList {
+			if err != nil {
+				r[i] = math.NaN()
+				continue
+			}
+			r[i] = math.Sqrt(md.weight()) * (s.raw.GetImVol(md.K, p) - math.Sqrt(md.V))
+		}
+		return r
+	}
+	lowerAll := []float64{1e-10, math.Inf(-1), 0, 0, math.Inf(-1)}
+	pStart, lower := make([]float64, len(free)), make([]float64, len(free))
+	for j, i := range free {
+		pStart[j], lower[j] = x[i], lowerAll[i]
+	}
+	res := lmSolve(residual, pStart, lower, nil, MaxIterations)
+	s.JWParams = jwFromSlice(expand(res.P))
+	return nil
+}
+
+func jwToSlice(jw *JWParams) []float64 {
+	return []float64{jw.V, jw.Psi, jw.P, jw.C, jw.VTilde}
+}
+
+func jwFromSlice(x []float64) *JWParams {
+	return &JWParams{V: x[0], Psi: x[1], P: x[2], C: x[3], VTilde: x[4]}
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	/*"github.com/go-nlopt/nlopt"*/
 	"gonum.org/v1/gonum/mat"
-	"log"
 	"math"
 	"os"
 	"os/exec"
@@ -34,6 +33,13 @@ func (s *Params) Copy() *Params {
 type MarketData struct {
 	K float64 //math.Log(StrikePrice / ForwardPrice)
 	V float64 //imVol*imVol
+
+	W            float64 // 拟合权重, Weighted 为true时生效, 可由 ApplyWeights 计算
+	Weighted     bool    // W 是否已设置, 为false时权重视为1
+	Spread       float64 // 买卖价差
+	OpenInterest float64 // 持仓量
+	BidV         float64 // 买价隐含波动率的平方, 为0时视为没有买价
+	AskV         float64 // 卖价隐含波动率的平方, 为0时视为没有卖价
 }
 
 type Boundary struct {
@@ -50,6 +56,16 @@ type Volatility struct {
 	xMatrix        *mat.VecDense
 	yMatrix        *mat.VecDense
 	T              float64 // （期权到期日-当前时间）/365天
+
+	FitMode  string     // 拟合方式 FitModeLM / FitModeQuasiExplicit / FitModeBand
+	RhoBound [2]float64 // 准显式拟合时 Rho 的上下界, 零值时使用 DefaultRhoBound
+	CBound   [2]float64 // 准显式拟合时 C 的上下界, 零值时使用 DefaultCBound
+
+	Arbitrage       string           // 拟合后蝶式套利的处理方式 ArbitrageIgnore / ArbitrageReject / ArbitrageRepair
+	ButterflyKGrid  []float64        // 检查蝶式套利的网格, 为nil时使用市场数据两侧各延伸1的区间
+	ButterflyReport *ButterflyReport // 最近一次拟合的蝶式套利检查结果
+	BandReport      *BandReport      // 最近一次 FitModeBand 拟合后落在报价区间外的点
+	FitReport       *FitReport       // 最近一次 FitVol 的拟合报告
 }
 
 func NewVolatility(T float64) *Volatility {
@@ -96,13 +112,38 @@ func (s *Volatility) SetBoundaryFunc(f func(k float64, b *Boundary, p *Params) f
 	s.boundaryFunc = f
 }
 
-// 曲线拟合返回参数
-func (s *Volatility) FitVol() *Params {
-	// prepare to call the Levenberg-Marquardt method
-	if s.A == 0 && s.B == 0 && s.C == 0 && s.Eta == 0 {
-		return s.Params
+// 曲线拟合返回参数和拟合报告
+// 拟合结果存在蝶式套利且被拒绝或无法修复时, 返回 nil 参数, report.Termination 为 TerminationButterflyArbitrage
+func (s *Volatility) FitVol() (*Params, *FitReport) {
+	report := &FitReport{}
+	s.FitReport = report
+	var p *Params
+	switch s.FitMode {
+	case FitModeQuasiExplicit, FitModeBand:
+		if len(s.MarketDataList) < 3 {
+			report.Termination = TerminationNotFitted
+			return s.Params, report
+		}
+		if s.FitMode == FitModeBand {
+			p = s.bandFit(s.MarketDataList, report)
+		} else {
+			p = s.quasiExplicitFit(s.MarketDataList, report)
+		}
+	default:
+		// prepare to call the Levenberg-Marquardt method
+		if s.A == 0 && s.B == 0 && s.C == 0 && s.Eta == 0 {
+			report.Termination = TerminationNotFitted
+			return s.Params, report
+		}
+		p = s.lmFit(s.xMatrix, s.yMatrix, s.Params, report)
 	}
-	return s.LMFit(s.xMatrix, s.yMatrix, s.Params)
+	p, err := s.checkButterfly(p)
+	if err != nil {
+		report.Termination = TerminationButterflyArbitrage
+		return nil, report
+	}
+	s.residualReport(p, report)
+	return p, report
 }
 
 // 根据参数和行权价格找到波动率
@@ -125,6 +166,8 @@ func Variance(kM, a, b, c, rho float64) float64 {
 	return a + b*(rho*kM+math.Sqrt(kM*kM+c*c))
 }
 
+// 由市场数据计算 LM 拟合的初值
+// 拟合目标 yMatrix 为隐含波动率 sqrt(V), 与模型值 F(k, p) 同为波动率, 不是总方差 V*T
 func (s *Volatility) InitParams(marketDataList []*MarketData) {
 
 	s.Params = &Params{}
@@ -137,7 +180,7 @@ func (s *Volatility) InitParams(marketDataList []*MarketData) {
 	varianceArr := make([]float64, 0)
 	for i, marketData := range s.MarketDataList {
 		s.xMatrix.SetVec(i, marketData.K)
-		s.yMatrix.SetVec(i, marketData.V*s.T)
+		s.yMatrix.SetVec(i, math.Sqrt(marketData.V))
 		moneynessArr = append(moneynessArr, marketData.K)
 		varianceArr = append(varianceArr, marketData.V*s.T)
 	}
@@ -216,21 +259,36 @@ const (
 )
 
 // Levenberg-Marquardt 最小二乘法
+// x, y 与 MarketDataList 长度一致时按 MarketDataList 的权重加权, 否则等权
 func (s *Volatility) LMFit(x, y *mat.VecDense, pStart *Params) *Params {
+	return s.lmFit(x, y, pStart, &FitReport{})
+}
+
+// 迭代次数, 终止原因和求解失败记录在 report 中
+func (s *Volatility) lmFit(x, y *mat.VecDense, pStart *Params, report *FitReport) *Params {
+	report.Termination = TerminationMaxIterations
 	resZero := Res0
 	nu := float64(Nu0)
 	dataLen := x.Len()
 	p := pStart.Copy()
 	rTranspose := mat.NewDense(1, dataLen, nil)
+	sw := s.sqrtWeights(dataLen)
 	for i := 0; i < MaxIterations; i++ {
+		report.Iterations = i + 1
 		fv := s.FVector(x, p)
 		for j := 0; j < dataLen; j++ {
-			rTranspose.Set(0, j, y.At(j, 0)-fv.AtVec(j))
+			rTranspose.Set(0, j, sw[j]*(y.At(j, 0)-fv.AtVec(j)))
 		}
 
 		res1 := math.Sqrt(mat.Dot(rTranspose.RowView(0), rTranspose.RowView(0)))
 
 		tmpGradFMatrix := s.GradFMatrix(x, p)
+		for j := 0; j < dataLen; j++ {
+			row := tmpGradFMatrix.RawRowView(j)
+			for c := range row {
+				row[c] *= sw[j]
+			}
+		}
 
 		betaTranspose := &mat.Dense{}
 		betaTranspose.Mul(rTranspose, tmpGradFMatrix)
@@ -245,9 +303,8 @@ func (s *Volatility) LMFit(x, y *mat.VecDense, pStart *Params) *Params {
 		}
 
 		dp := &mat.Dense{}
-		err := dp.Solve(alpha, beta)
-		if err != nil {
-			log.Printf("LMFit dp.solve fail, err: %s, alpha: %+v, beta: %+v ", err, alpha, beta)
+		if err := dp.Solve(alpha, beta); err != nil {
+			report.SolveFailed = true
 		}
 
 		pNew := p.Copy()
@@ -259,7 +316,7 @@ func (s *Volatility) LMFit(x, y *mat.VecDense, pStart *Params) *Params {
 
 		fv = s.FVector(x, pNew)
 		for j := 0; j < dataLen; j++ {
-			rTranspose.Set(0, j, y.At(j, 0)-fv.At(j, 0))
+			rTranspose.Set(0, j, sw[j]*(y.At(j, 0)-fv.At(j, 0)))
 		}
 
 		res := math.Sqrt(mat.Dot(rTranspose.RowView(0), rTranspose.RowView(0)))
@@ -272,6 +329,7 @@ func (s *Volatility) LMFit(x, y *mat.VecDense, pStart *Params) *Params {
 		}
 
 		if math.Abs(res-resZero) < Tolerance {
+			report.Termination = TerminationConverged
 			break
 		}
 		resZero = res
@@ -295,6 +353,22 @@ func (s *Volatility) LMFit(x, y *mat.VecDense, pStart *Params) *Params {
 	return p
 }
 
+// MarketDataList 中各点权重的平方根
+// MarketDataList 为空或与数据长度不一致(如 LMFit 传入自定义数据)时权重无法对应到数据点, 等权
+func (s *Volatility) sqrtWeights(dataLen int) []float64 {
+	sw := make([]float64, dataLen)
+	if len(s.MarketDataList) != dataLen {
+		for j := range sw {
+			sw[j] = 1
+		}
+		return sw
+	}
+	for j := range sw {
+		sw[j] = math.Sqrt(s.MarketDataList[j].weight())
+	}
+	return sw
+}
+
 func (s *Volatility) FVector(x *mat.VecDense, p *Params) *mat.VecDense {
 	dataLen := x.Len()
 	outline := mat.NewVecDense(dataLen, nil)
@@ -304,6 +378,7 @@ func (s *Volatility) FVector(x *mat.VecDense, p *Params) *mat.VecDense {
 	return mat.VecDenseCopyOf(outline.TVec())
 }
 
+// LM 拟合的模型值, 即参数 p 在 k 处的隐含波动率
 func (s *Volatility) F(k float64, p *Params) float64 {
 	kM := k - p.Eta
 	return math.Sqrt(math.Abs((p.A + p.B*(p.Rho*kM+math.Sqrt(kM*kM+p.C*p.C))) / s.T))
@@ -330,31 +405,35 @@ func (s *Volatility) GradF(k float64, p *Params) []float64 {
 	tmp2 := Variance(kM, 0, 1, p.C, 0)
 
 	res[0] = tmp
-	res[1] = tmp * tmp2
-	res[2] = tmpB * p.C / tmp1
+	res[1] = tmp * tmp1
+	res[2] = tmpB * p.C / tmp2
 	res[3] = tmpB * kM
-	res[4] = -tmpB * (p.Rho + kM/tmp1)
+	res[4] = -tmpB * (p.Rho + kM/tmp2)
 
 	return res
 }
 
 // 调用python的scipy实现slsqp
 // need install python3,numpy,scipy
+//
+// Deprecated: 依赖 python3 和当前工作目录, 使用 MinimizeConstrained
 func (s *Volatility) PyMinimizeSLSQP(marketDataList []*MarketData) (*Params, error) {
-	kBuf, vBuf := bytes.Buffer{}, bytes.Buffer{}
+	kBuf, vBuf, wBuf := bytes.Buffer{}, bytes.Buffer{}, bytes.Buffer{}
 	for _, marketData := range marketDataList {
 		kBuf.WriteString(",")
 		kBuf.WriteString(strconv.FormatFloat(marketData.K, 'f', -1, 64))
 
 		vBuf.WriteString(",")
 		vBuf.WriteString(strconv.FormatFloat(marketData.V*s.T, 'f', -1, 64))
+
+		wBuf.WriteString(",")
+		wBuf.WriteString(strconv.FormatFloat(marketData.weight(), 'f', -1, 64))
 	}
 
-	command, args := "python3", []string{"minimize_slsqp.py", "-k " + kBuf.String()[1:], "-v " + vBuf.String()[1:]}
+	command, args := "python3", []string{"minimize_slsqp.py", "-k " + kBuf.String()[1:], "-v " + vBuf.String()[1:], "-w " + wBuf.String()[1:]}
 	//command, args := "ls", []string{"-a"}
 	//command, args := "python3", []string{"minimize_slsqp.py"}
 	cmd := exec.Command(command, args...)
-	log.Printf("%+v", cmd.String())
 	var out bytes.Buffer
 	cmd.Stdout = &out
 	cmd.Stderr = os.Stderr
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	/*"github.com/go-nlopt/nlopt"*/
 	"gonum.org/v1/gonum/mat"
-	"log"
 	"math"
 	"os"
 	"os/exec"
@@ -36,6 +35,9 @@ type MarketDataOld struct {
 	ImVol       float64
 }
 
+// 行权价格空间的 SVI 拟合
+//
+// Deprecated: 使用 MarketDataFromStrikes 转换数据后调用 Volatility, 或其他 SmileModel 实现
 type VolatilityOld struct {
 	*ParamsOld
 	MarketDataList []*MarketDataOld
@@ -46,6 +48,7 @@ type VolatilityOld struct {
 	kMap           map[float64]float64
 }
 
+// Deprecated: 使用 NewVolatility
 func NewVolatilityOld(ForwardPrice float64, T float64) *VolatilityOld {
 	s := &VolatilityOld{
 		ForwardPrice: ForwardPrice,
@@ -201,9 +204,9 @@ func (s *VolatilityOld) LMFit(x, y *mat.VecDense, pStart *ParamsOld) *ParamsOld
 		}
 
 		dp := &mat.Dense{}
-		err := dp.Solve(alpha, beta)
-		if err != nil {
-			log.Printf("LMFit dp.solve fail, err: %s, alpha: %+v, beta: %+v ", err, alpha, beta)
+		// 正规方程求解失败时停止迭代, 保留当前参数; 需要诊断信息时使用 Volatility.FitVol
+		if err := dp.Solve(alpha, beta); err != nil {
+			break
 		}
 
 		pNew := p.Copy()
@@ -288,10 +291,10 @@ func (s *VolatilityOld) GradF(strikePrice float64, p *ParamsOld) []float64 {
 	tmp2 := VarianceOld(kM, 0, 1, p.C, 0)
 
 	res[0] = tmp
-	res[1] = tmp * tmp2
-	res[2] = tmpB * p.C / tmp1
+	res[1] = tmp * tmp1
+	res[2] = tmpB * p.C / tmp2
 	res[3] = tmpB * kM
-	res[4] = -tmpB * (p.Rho + kM/tmp1)
+	res[4] = -tmpB * (p.Rho + kM/tmp2)
 
 	return res
 }
@@ -314,7 +317,6 @@ func (s *VolatilityOld) PyMinimizeSLSQP(marketDataList []*MarketDataOld) (*Param
 	//command, args := "ls", []string{"-a"}
 	//command, args := "python3", []string{"minimize_slsqp.py"}
 	cmd := exec.Command(command, args...)
-	log.Printf("%+v", cmd.String())
 	var out bytes.Buffer
 	cmd.Stdout = &out
 	cmd.Stderr = os.Stderr
@@ -132,7 +132,8 @@ func TestVolatility_FitVol(t *testing.T) {
 
 	s1 := generateS1()
 	s1.InitParams(marketDataList1)
-	t.Logf("Param1: %+v", s1.FitVol())
+	p1, report := s1.FitVol()
+	t.Logf("Param1: %+v, report: %+v", p1, report)
 }
 
 // goos: windows
@@ -330,3 +331,761 @@ func TestVolatility_GetImVol(t *testing.T) {
 	bsm := blackscholes.NewBS("c", 25490.88, 25000, T, 0, 0.1, 0.01, 3, 0.01)
 	log.Printf("optionsPrice: %+v", bsm.GetOptionPriceFromIv(13.630501173527113))
 }
+
+func TestHeston_Price(t *testing.T) {
+	// Fang & Oosterlee (2008) Table 4: S=K=100, T=1, r=0, 参考价格 5.785155450
+	h := NewHeston()
+	p := &HestonParams{V0: 0.0175, Kappa: 1.5768, Theta: 0.0398, Sigma: 0.5751, Rho: -0.5711}
+	if price := 100 * h.CallPrice(0, 1, p); math.Abs(price-5.785155450) > 1e-6 {
+		t.Errorf("heston call: got %v, want 5.785155450", price)
+	}
+	// Sigma趋于0且V0=Theta时退化为BS
+	p = &HestonParams{V0: 0.04, Kappa: 1, Theta: 0.04, Sigma: 1e-4, Rho: 0}
+	for _, k := range []float64{-0.3, 0, 0.3} {
+		if iv := h.GetImVol(k, 0.5, p); math.Abs(iv-0.2) > 1e-5 {
+			t.Errorf("k=%v: iv %v, want 0.2", k, iv)
+		}
+	}
+	// 深度虚值价格为0, 无法反推隐含波动率
+	if iv := h.GetImVol(5, 0.01, p); !math.IsNaN(iv) {
+		t.Errorf("deep otm iv %v, want NaN", iv)
+	}
+}
+
+func TestHeston_FitVol(t *testing.T) {
+	want := &HestonParams{V0: 0.36, Kappa: 2, Theta: 0.5, Sigma: 1.2, Rho: -0.3}
+	h := NewHeston()
+	expiryDataList := make([]*ExpiryData, 0)
+	for _, T := range []float64{7.0 / 365, 30.0 / 365, 90.0 / 365} {
+		e := &ExpiryData{T: T}
+		for _, k := range []float64{-0.3, -0.2, -0.1, -0.05, 0, 0.05, 0.1, 0.2, 0.3} {
+			k := k * math.Sqrt(T/(30.0/365))
+			iv := h.GetImVol(k, T, want)
+			e.MarketDataList = append(e.MarketDataList, &MarketData{K: k, V: iv * iv})
+		}
+		expiryDataList = append(expiryDataList, e)
+	}
+	h.InitParams(expiryDataList)
+	p := h.FitVol()
+	for _, e := range expiryDataList {
+		for _, md := range e.MarketDataList {
+			if iv := h.GetImVol(md.K, e.T, p); math.Abs(iv-math.Sqrt(md.V)) > 1e-4 {
+				t.Errorf("T=%v k=%v: fit iv %v, market iv %v", e.T, md.K, iv, math.Sqrt(md.V))
+			}
+		}
+	}
+	// 回归检查: lmSolve 的终止条件改动前后参数一致
+	if math.Abs(p.V0-want.V0) > 1e-8 || math.Abs(p.Kappa-want.Kappa) > 1e-8 || math.Abs(p.Theta-want.Theta) > 1e-8 ||
+		math.Abs(p.Sigma-want.Sigma) > 1e-8 || math.Abs(p.Rho-want.Rho) > 1e-8 {
+		t.Errorf("fit params %+v, want %+v", p, want)
+	}
+	t.Logf("fit params: %+v", p)
+}
+
+func TestLmSolve(t *testing.T) {
+	// 残差放大后终止条件按残差相对变化判断, 拟合结果与未放大时一致
+	fit := func(scale float64) *lmResult {
+		return lmSolve(func(p []float64) []float64 {
+			r := make([]float64, 10)
+			for i := range r {
+				x := float64(i) / 10
+				r[i] = scale * (p[0]*math.Exp(p[1]*x) - math.Exp(0.5*x) - 0.1*math.Pow(-1, float64(i)))
+			}
+			return r
+		}, []float64{0.5, 0}, nil, nil, 100)
+	}
+	small, large := fit(1), fit(1e4)
+	if small.Iterations >= 100 || large.Iterations >= 100 {
+		t.Fatalf("iterations: %d, %d", small.Iterations, large.Iterations)
+	}
+	for j := range small.P {
+		if math.Abs(small.P[j]-large.P[j]) > 1e-6 {
+			t.Errorf("p[%d]: %v, scaled %v", j, small.P[j], large.P[j])
+
+		}
+	}
+}
+func TestSabr_GetImVol(t *testing.T) {
+	F, T := 30000.0, 30.0/365
+	// beta=1, nu趋于0时为常数波动率
+	s := NewSabr(F, T, 1)
+	flat := &SabrParams{Alpha: 0.6, Beta: 1, Rho: 0, Nu: 1e-10}
+	for _, k := range []float64{-0.3, 0, 0.3} {
+		if iv := s.GetImVol(k, flat); math.Abs(iv-0.6) > 1e-9 {
+			t.Errorf("flat k=%v: %v", k, iv)
+		}
+	}
+	// 平值处正态波动率约为 F*对数正态波动率*(1-σ²T/24)
+	p := &SabrParams{Alpha: 0.6 * math.Pow(F, 0.5), Beta: 0.5, Rho: -0.2, Nu: 1.5}
+	lognormal := s.GetImVol(0, p)
+	s.Normal = true
+	if normal := s.GetImVol(0, p); math.Abs(normal/(F*lognormal*(1-lognormal*lognormal*T/24))-1) > 1e-3 {
+		t.Errorf("atm normal %v, lognormal %v", normal, lognormal)
+	}
+}
+
+func TestSabr_FitVol(t *testing.T) {
+	F, T := 30000.0, 30.0/365
+	want := &SabrParams{Alpha: 0.6 * math.Pow(F, 0.5), Beta: 0.5, Rho: -0.2, Nu: 1.5}
+	for _, normal := range []bool{false, true} {
+		for _, fitBeta := range []bool{false, true} {
+			s := NewSabr(F, T, 0.5)
+			s.Normal, s.FitBeta = normal, fitBeta
+			list := make([]*MarketData, 0)
+			for _, k := range []float64{-0.3, -0.2, -0.1, -0.05, 0, 0.05, 0.1, 0.2, 0.3} {
+				iv := s.GetImVol(k, want)
+				list = append(list, &MarketData{K: k, V: iv * iv})
+			}
+			if fitBeta {
+				s.Beta = 0.8
+			}
+			s.InitParams(list)
+			p := s.FitVol()
+			for _, md := range list {
+				if iv := s.GetImVol(md.K, p); math.Abs(iv/math.Sqrt(md.V)-1) > 1e-4 {
+					t.Errorf("normal=%v fitBeta=%v k=%v: fit iv %v, market iv %v", normal, fitBeta, md.K, iv, math.Sqrt(md.V))
+				}
+			}
+			if !fitBeta && (math.Abs(p.Alpha/want.Alpha-1) > 1e-6 || math.Abs(p.Rho-want.Rho) > 1e-6 || math.Abs(p.Nu-want.Nu) > 1e-6) {
+				t.Errorf("normal=%v: params %+v, want %+v", normal, p, want)
+			}
+			t.Logf("normal=%v fitBeta=%v params: %+v", normal, fitBeta, p)
+		}
+	}
+}
+
+func TestVolatility_LMFit(t *testing.T) {
+	// GradF 与中心差分一致
+	T := 30.0 / 365
+	want := &Params{A: 0.01, B: 0.1, C: 0.2, Rho: -0.4, Eta: 0.05}
+	s, old := NewVolatility(T), NewVolatilityOld(100, T)
+	old.kMap = make(map[float64]float64)
+	toParams := func(x []float64) *Params {
+		return &Params{A: x[0], B: x[1], C: x[2], Rho: x[3], Eta: x[4]}
+	}
+	for _, k := range []float64{-0.3, 0, 0.2} {
+		strike := 100 * math.Exp(k)
+		old.kMap[strike] = k
+		x := []float64{want.A, want.B, want.C, want.Rho, want.Eta}
+		grad := s.GradF(k, want)
+		gradOld := old.GradF(strike, &ParamsOld{A: want.A, B: want.B, C: want.C, Rho: want.Rho, Eta: want.Eta})
+		for j := range x {
+			up, down := append([]float64{}, x...), append([]float64{}, x...)
+			up[j], down[j] = x[j]+1e-7, x[j]-1e-7
+			numeric := (s.F(k, toParams(up)) - s.F(k, toParams(down))) / 2e-7
+			if math.Abs(grad[j]-numeric) > 1e-5*math.Max(1, math.Abs(numeric)) || math.Abs(gradOld[j]-grad[j]) > 1e-12 {
+				t.Errorf("k=%v grad[%d]: %v, old %v, numeric %v", k, j, grad[j], gradOld[j], numeric)
+			}
+		}
+	}
+
+	// LMFit 拟合隐含波动率, 由已知参数生成的数据可以还原
+	list := make([]*MarketData, 0)
+	for _, k := range []float64{-0.4, -0.3, -0.2, -0.1, -0.05, 0, 0.05, 0.1, 0.2, 0.3, 0.4} {
+		list = append(list, &MarketData{K: k, V: s.GetVariance(k, want) / T})
+	}
+	s.InitParams(list)
+	p, _ := s.FitVol()
+	for _, md := range list {
+		if iv := s.GetImVol(md.K, p); math.Abs(iv-math.Sqrt(md.V)) > 1e-4 {
+			t.Errorf("k=%v: iv %v, market %v", md.K, iv, math.Sqrt(md.V))
+		}
+	}
+}
+
+func TestVolatility_LMFitTarget(t *testing.T) {
+	// LM 的拟合目标是隐含波动率 sqrt(V), 与 F 的单位一致; 以总方差 V*T 为目标时真实参数处残差不为零
+	T := 30.0 / 365
+	want := &Params{A: 0.01, B: 0.1, C: 0.2, Rho: -0.4, Eta: 0.05}
+	s := NewVolatility(T)
+	list := make([]*MarketData, 0)
+	for _, k := range []float64{-0.4, -0.3, -0.2, -0.1, -0.05, 0, 0.05, 0.1, 0.2, 0.3, 0.4} {
+		list = append(list, &MarketData{K: k, V: s.GetVariance(k, want) / T})
+	}
+	s.InitParams(list)
+	for i, md := range list {
+		if y := s.yMatrix.AtVec(i); y != math.Sqrt(md.V) {
+			t.Errorf("k=%v: target %v, want sqrt(V) %v", md.K, y, math.Sqrt(md.V))
+		}
+		if f := s.F(md.K, want); math.Abs(f-s.yMatrix.AtVec(i)) > 1e-14 {
+			t.Errorf("k=%v: F at true params %v, target %v", md.K, f, s.yMatrix.AtVec(i))
+		}
+	}
+	p, report := s.FitVol()
+	if report.RMSE > 1e-6 {
+		t.Errorf("rmse %v, report: %+v", report.RMSE, report)
+	}
+	for _, md := range list {
+		if v := s.GetVariance(md.K, p); math.Abs(v-md.V*T) > 1e-6 {
+			t.Errorf("k=%v: total variance %v, market %v", md.K, v, md.V*T)
+		}
+	}
+}
+
+func TestSmileModel(t *testing.T) {
+	T := 0.00194
+	// 全局的 marketDataList 会被 TestVolatility_PyMinimizeSLSQP 替换, 这里使用独立的数据
+	strikes := []*MarketDataOld{
+		{StrikePrice: 3500, ImVol: 0.31203},
+		{StrikePrice: 4000, ImVol: 0.25041},
+		{StrikePrice: 4500, ImVol: 0.19897},
+		{StrikePrice: 5000, ImVol: 0.15795},
+		{StrikePrice: 5500, ImVol: 0.13803},
+		{StrikePrice: 6000, ImVol: 0.14575},
+		{StrikePrice: 6400, ImVol: 0.17007},
+	}
+	list := MarketDataFromStrikes(5066.5, strikes)
+	if len(list) != len(strikes) || math.Abs(list[0].K-math.Log(3500/5066.5)) > 1e-15 {
+		t.Fatalf("MarketDataFromStrikes: %+v", list[0])
+	}
+	svi := NewVolatility(T)
+	sabr := NewSabr(5066.5, T, 1)
+	for name, model := range map[string]SmileModel{"svi": svi, "sabr": sabr} {
+		if err := model.Fit(list[:2]); err != ErrNotEnoughData {
+			t.Errorf("%s: err %v, want %v", name, err, ErrNotEnoughData)
+		}
+		if err := model.Fit(list); err != nil {
+			t.Errorf("%s fit err: %v", name, err)
+			continue
+		}
+		for _, md := range list {
+			iv := model.ImVol(md.K)
+			if math.Abs(model.TotalVariance(md.K)-iv*iv*T) > 1e-15 {
+				t.Errorf("%s k=%v: total variance %v, iv %v", name, md.K, model.TotalVariance(md.K), iv)
+			}
+			if math.Abs(iv-math.Sqrt(md.V)) > 0.01 {
+				t.Errorf("%s k=%v: iv %v, market %v", name, md.K, iv, math.Sqrt(md.V))
+			}
+		}
+	}
+
+	// 解析梯度与数值梯度一致
+	p := svi.Params
+	numeric := numericGrad(func(x []float64) float64 {
+		return svi.GetImVol(0.05, &Params{A: x[0], B: x[1], C: x[2], Rho: x[3], Eta: x[4]})
+	}, []float64{p.A, p.B, p.C, p.Rho, p.Eta})
+	for j, g := range svi.ParamsGrad(0.05) {
+		if math.Abs(g-numeric[j]) > 1e-5*math.Max(1, math.Abs(g)) {
+			t.Errorf("svi grad[%d]: %v, numeric %v", j, g, numeric[j])
+		}
+	}
+	if g := sabr.ParamsGrad(0); len(g) != 4 || g[0] <= 0 {
+		t.Errorf("sabr grad: %v", g)
+	}
+}
+
+func TestJWParams(t *testing.T) {
+	T := 30.0 / 365
+	for _, p := range []*Params{
+		{A: 0.01, B: 0.1, C: 0.2, Rho: -0.4, Eta: 0.05},
+		{A: 0.02, B: 0.3, C: 0.1, Rho: 0.3, Eta: -0.1},
+		{A: 0.01, B: 0.2, C: 0.15, Rho: -0.6, Eta: 0},
+		{A: -0.01, B: 0.05, C: 0.5, Rho: 0.1, Eta: 0.2},
+	} {
+		jw, err := RawToJW(p, T)
+		if err != nil {
+			t.Errorf("RawToJW %+v err: %v", p, err)
+			continue
+		}
+		raw, err := JWToRaw(jw, T)
+		if err != nil {
+			t.Errorf("JWToRaw %+v err: %v", jw, err)
+			continue
+		}
+		for name, v := range map[string][2]float64{"a": {raw.A, p.A}, "b": {raw.B, p.B}, "c": {raw.C, p.C}, "rho": {raw.Rho, p.Rho}, "eta": {raw.Eta, p.Eta}} {
+			if math.Abs(v[0]-v[1]) > 1e-12 {
+				t.Errorf("%+v round trip %s: %v", p, name, v[0])
+			}
+		}
+	}
+	if _, err := JWToRaw(&JWParams{V: 0.04, Psi: 0, P: 0.5, C: 0.5, VTilde: 0.04}, T); err != ErrInvalidJW {
+		t.Errorf("degenerate err: %v, want %v", err, ErrInvalidJW)
+	}
+}
+
+func TestSviJW_Fit(t *testing.T) {
+	T := 30.0 / 365
+	want := &Params{A: 0.01, B: 0.1, C: 0.2, Rho: -0.4, Eta: 0.05}
+	s := NewSviJW(T)
+	list := make([]*MarketData, 0)
+	for _, k := range []float64{-0.4, -0.3, -0.2, -0.1, -0.05, 0, 0.05, 0.1, 0.2, 0.3, 0.4} {
+		list = append(list, &MarketData{K: k, V: s.raw.GetVariance(k, want) / T})
+	}
+	if err := s.Fit(list); err != nil {
+		t.Fatalf("fit err: %v", err)
+	}
+	for _, md := range list {
+		if iv := s.ImVol(md.K); math.Abs(iv-math.Sqrt(md.V)) > 1e-4 {
+			t.Errorf("k=%v: iv %v, market %v", md.K, iv, math.Sqrt(md.V))
+		}
+	}
+
+	// 固定左翼斜率后重新拟合, 其余参数调整
+	s.P = s.P * 1.2
+	s.Fixed = [5]bool{false, false, true, false, false}
+	fixedP := s.P
+	if err := s.Fit(list); err != nil || s.P != fixedP {
+		t.Errorf("fixed P: %v, want %v, err: %v", s.P, fixedP, err)
+	}
+	if raw, err := s.Raw(); err != nil || s.ImVol(0) != s.raw.GetImVol(0, raw) {
+		t.Errorf("raw %+v, err: %v", raw, err)
+	}
+	if g := s.ParamsGrad(0); len(g) != 5 || g[0] <= 0 {
+		t.Errorf("grad: %v", g)
+	}
+}
+
+func TestSsvi_Fit(t *testing.T) {
+	want := &Ssvi{
+		SsviParams: &SsviParams{Rho: -0.35, Eta: 1.2, Gamma: 0.4, Thetas: []float64{0.004, 0.012, 0.03, 0.07}},
+		Ts:         []float64{7.0 / 365, 30.0 / 365, 90.0 / 365, 180.0 / 365},
+	}
+	expiryDataList := make([]*ExpiryData, 0)
+	for _, T := range want.Ts {
+		e := &ExpiryData{T: T}
+		for _, k := range []float64{-0.4, -0.2, -0.1, 0, 0.1, 0.2, 0.4} {
+			iv := want.ImVol(k*math.Sqrt(T*4), T)
+			e.MarketDataList = append(e.MarketDataList, &MarketData{K: k * math.Sqrt(T*4), V: iv * iv})
+		}
+		expiryDataList = append(expiryDataList, e)
+	}
+	s := NewSsvi()
+	if err := s.Fit(expiryDataList); err != nil {
+		t.Fatalf("fit err: %v", err)
+	}
+	for _, e := range expiryDataList {
+		for _, md := range e.MarketDataList {
+			if iv := s.ImVol(md.K, e.T); math.Abs(iv-math.Sqrt(md.V)) > 1e-5 {
+				t.Errorf("T=%v k=%v: iv %v, market %v", e.T, md.K, iv, math.Sqrt(md.V))
+			}
+		}
+	}
+	if s.Eta*(1+math.Abs(s.Rho)) > 2+1e-12 || s.Gamma < 0 || s.Gamma > 0.5 {
+		t.Errorf("params violate no-arbitrage constraints: %+v", s.SsviParams)
+	}
+
+	// 任意期限的总方差随期限递增, 包括插值和外推区间
+	for _, k := range []float64{-0.5, 0, 0.5} {
+		prev := 0.0
+		for T := 1.0 / 365; T < 1; T += 1.0 / 365 {
+			w := s.TotalVariance(k, T)
+			if w < prev {
+				t.Errorf("calendar arbitrage at k=%v T=%v: %v < %v", k, T, w, prev)
+				break
+			}
+			prev = w
+		}
+	}
+
+	// 切片与曲面一致, 单独拟合切片不影响曲面
+	T := 60.0 / 365
+	slice := s.Slice(T)
+	if math.Abs(slice.ImVol(0.1)-s.ImVol(0.1, T)) > 1e-15 || len(slice.ParamsGrad(0.1)) != 4 {
+		t.Errorf("slice %+v", slice)
+	}
+	slice = s.Slice(expiryDataList[1].T)
+	if err := slice.Fit(expiryDataList[1].MarketDataList); err != nil || math.Abs(slice.ImVol(0.1)-s.ImVol(0.1, slice.T)) > 1e-4 {
+		t.Errorf("slice fit %+v, err: %v", slice, err)
+	}
+}
+
+func TestCheckButterfly(t *testing.T) {
+	// Axel Vogt 的例子, k≈[0.6, 1.4] 附近 g(k)<0
+	vogt := &Params{A: -0.0410, B: 0.1331, C: 0.4153, Rho: 0.3060, Eta: 0.3586}
+	grid := KGrid(-1.5, 2.5, 401)
+	report := CheckButterfly(vogt, grid)
+	if report.Free() || len(report.Regions) != 1 {
+		t.Fatalf("regions: %v", report.Regions)
+	}
+	if r := report.Regions[0]; r.KStart > 1 || r.KEnd < 1 || r.Min >= 0 {
+		t.Errorf("region: %+v", r)
+	}
+	if report := CheckButterfly(&Params{A: 0.01, B: 0.1, C: 0.2, Rho: -0.4, Eta: 0.05}, grid); !report.Free() {
+		t.Errorf("regions: %v", report.Regions)
+	}
+
+	repaired, err := RepairButterfly(vogt, grid)
+	if err != nil || !CheckButterfly(repaired, grid).Free() {
+		t.Fatalf("repaired params %+v still has arbitrage, err: %v", repaired, err)
+	}
+	if atm, want := Variance(-repaired.Eta, repaired.A, repaired.B, repaired.C, repaired.Rho), Variance(-vogt.Eta, vogt.A, vogt.B, vogt.C, vogt.Rho); math.Abs(atm-want) > 1e-12 {
+		t.Errorf("atm variance %v, want %v", atm, want)
+	}
+	// 平值总方差非正时无法修复
+	if p, err := RepairButterfly(&Params{A: -0.1, B: 0.01, C: 0.1, Rho: 0, Eta: 0}, grid); err != ErrButterflyArbitrage || p != nil {
+		t.Errorf("negative atm variance repaired to %+v, err: %v", p, err)
+	}
+
+	// 拟合结果存在套利时按 Arbitrage 拒绝或修复
+	list := make([]*MarketData, 0)
+	for _, k := range []float64{-1, -0.5, -0.2, 0, 0.2, 0.5, 0.8, 1, 1.2, 1.5} {
+		list = append(list, &MarketData{K: k, V: Variance(k-vogt.Eta, vogt.A, vogt.B, vogt.C, vogt.Rho)})
+	}
+	s := NewVolatility(1)
+	s.Arbitrage = ArbitrageReject
+	s.ButterflyKGrid = grid
+	if err := s.Fit(list); err != ErrButterflyArbitrage || s.ButterflyReport.Free() || s.Params != nil || s.FitReport.Termination != TerminationButterflyArbitrage {
+		t.Errorf("reject err: %v, params: %+v", err, s.Params)
+	}
+	s.Arbitrage = ArbitrageRepair
+	if err := s.Fit(list); err != nil || !s.ButterflyReport.Free() {
+		t.Errorf("repair err: %v, regions: %v", err, s.ButterflyReport.Regions)
+	}
+	// 再次拟合被拒绝时保留之前无套利的参数
+	good := *s.Params
+	s.Arbitrage = ArbitrageReject
+	if err := s.Fit(list); err != ErrButterflyArbitrage || s.Params == nil || *s.Params != good {
+		t.Errorf("rejected refit err: %v, params: %+v, want %+v", err, s.Params, good)
+	}
+}
+
+func TestCheckCalendar(t *testing.T) {
+	short, long := NewVolatility(0.1), NewVolatility(0.2)
+	short.Params = &Params{A: 0.01, B: 0.1, C: 0.2, Rho: -0.4, Eta: 0.05}
+	long.Params = &Params{A: 0.03, B: 0.05, C: 0.2, Rho: -0.4, Eta: 0.05}
+	grid := KGrid(-1.5, 1.5, 301)
+	// 期限无需有序
+	report, err := CheckCalendar([]float64{0.2, 0.1}, []SmileModel{long, short}, grid)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if report.Ts[0] != 0.1 || len(report.Regions) != 2 {
+		t.Fatalf("ts: %v, regions: %v", report.Ts, report.Regions)
+	}
+	left, right := report.Regions[0], report.Regions[1]
+	if left.KStart != -1.5 || left.KEnd >= 0 || right.KStart <= 0 || right.KEnd != 1.5 {
+		t.Errorf("left: %+v, right: %+v", left, right)
+	}
+	if want := short.TotalVariance(-1.5) - long.TotalVariance(-1.5); left.T1 != 0.1 || left.T2 != 0.2 || math.Abs(left.Max-want) > 1e-15 {
+		t.Errorf("left: %+v, want max %v", left, want)
+	}
+
+	// SSVI 曲面的切片之间无日历套利
+	surface := &Ssvi{SsviParams: &SsviParams{Rho: -0.3, Eta: 1, Gamma: 0.4, Thetas: []float64{0.01, 0.02, 0.05}}, Ts: []float64{0.1, 0.25, 0.5}}
+	models := make([]SmileModel, 0)
+	for _, T := range surface.Ts {
+		models = append(models, surface.Slice(T))
+	}
+	if report, err := CheckCalendar(surface.Ts, models, grid); err != nil || !report.Free() {
+		t.Errorf("ssvi regions: %v, err: %v", report.Regions, err)
+	}
+	if _, err := CheckCalendar([]float64{0.1}, models, grid); err != ErrCalendarInput {
+		t.Errorf("err: %v, want %v", err, ErrCalendarInput)
+	}
+}
+
+func TestVolatility_MinimizeConstrained(t *testing.T) {
+	// 与 minimize_slsqp.py 注释中的数据相同, 右翼约束在最优点处起作用
+	ks := []float64{-0.1524, -0.0879, -0.0273, 0.0299, 0.0839, 0.1352, 0.2530}
+	ws := []float64{0.01018, 0.00820, 0.00720, 0.00597, 0.00663, 0.00568, 0.01289}
+	list := make([]*MarketData, 0)
+	for i := range ks {
+		list = append(list, &MarketData{K: ks[i], V: ws[i]})
+	}
+	s := NewVolatility(1)
+	p, report, err := s.MinimizeConstrained(list)
+	if err != nil || !report.Converged || report.MaxViolation > ConstrainedTolerance {
+		t.Fatalf("report: %+v, err: %v", report, err)
+	}
+	if math.Abs(report.Constraints[0]) > 1e-8 {
+		t.Errorf("constraint1 not active: %v", report.Constraints)
+	}
+	if p.A < 0.000001 || p.B < 0.001 || p.B > 1 || p.C < 0.001 || p.C > 2 || p.Eta < 2*ks[0] || p.Eta > 2*ks[len(ks)-1] {
+		t.Errorf("params out of bounds: %+v", p)
+	}
+	sum := 0.0
+	for _, md := range list {
+		r := s.GetVariance(md.K, p) - md.V
+		sum += r * r
+	}
+	if math.Abs(math.Sqrt(sum)-report.Objective) > 1e-15 || report.Objective > 0.002 {
+		t.Errorf("objective: %v, residual norm %v", report.Objective, math.Sqrt(sum))
+	}
+
+	// 约束不起作用时还原生成数据的参数
+	T := 30.0 / 365
+	want := &Params{A: 0.01, B: 0.1, C: 0.2, Rho: -0.4, Eta: 0.05}
+	list = list[:0]
+	for _, k := range []float64{-0.4, -0.3, -0.2, -0.1, -0.05, 0, 0.05, 0.1, 0.2, 0.3, 0.4} {
+		list = append(list, &MarketData{K: k, V: s.GetVariance(k, want) / T})
+	}
+	s = NewVolatility(T)
+	p, report, err = s.MinimizeConstrained(list)
+	if err != nil || !report.Converged || s.Params != p {
+		t.Fatalf("report: %+v, err: %v", report, err)
+	}
+	if math.Abs(p.A-want.A) > 1e-6 || math.Abs(p.B-want.B) > 1e-6 || math.Abs(p.C-want.C) > 1e-6 || math.Abs(p.Rho-want.Rho) > 1e-6 || math.Abs(p.Eta-want.Eta) > 1e-6 {
+		t.Errorf("params %+v, want %+v", p, want)
+	}
+	if _, _, err := s.MinimizeConstrained(nil); err != ErrNotEnoughData {
+		t.Errorf("err: %v, want %v", err, ErrNotEnoughData)
+	}
+	// 总方差全部为0
+	if _, _, err := s.MinimizeConstrained([]*MarketData{{K: -0.1}, {K: 0}, {K: 0.1}}); err != ErrNotEnoughData {
+		t.Errorf("zero variance err: %v, want %v", err, ErrNotEnoughData)
+	}
+}
+
+func TestVolatility_QuasiExplicitFit(t *testing.T) {
+	T := 30.0 / 365
+	want := &Params{A: 0.01, B: 0.1, C: 0.2, Rho: -0.4, Eta: 0.05}
+	s := NewVolatility(T)
+	list := make([]*MarketData, 0)
+	for _, k := range []float64{-0.4, -0.3, -0.2, -0.1, -0.05, 0, 0.05, 0.1, 0.2, 0.3, 0.4} {
+		list = append(list, &MarketData{K: k, V: s.GetVariance(k, want) / T})
+	}
+	s.FitMode = FitModeQuasiExplicit
+	if err := s.Fit(list); err != nil {
+		t.Fatalf("fit err: %v", err)
+	}
+	p := s.Params
+	if math.Abs(p.A-want.A) > 1e-6 || math.Abs(p.B-want.B) > 1e-6 || math.Abs(p.C-want.C) > 1e-6 || math.Abs(p.Rho-want.Rho) > 1e-6 || math.Abs(p.Eta-want.Eta) > 1e-6 {
+		t.Errorf("params %+v, want %+v", p, want)
+	}
+
+	// 上下界起作用
+	s.RhoBound = [2]float64{-0.2, 0.2}
+	s.CBound = [2]float64{0.3, 1}
+	if err := s.Fit(list); err != nil {
+		t.Fatalf("fit err: %v", err)
+	}
+	if p := s.Params; p.Rho < -0.2-1e-12 || p.Rho > 0.2+1e-12 || p.C < 0.3 || p.C > 1 || p.B <= 0 || p.A < -1e-15 {
+		t.Errorf("params out of bounds: %+v", p)
+	}
+
+	// 市场数据上不依赖初值, A 受约束非负
+	quasi := NewVolatility(0.00194)
+	quasi.FitMode = FitModeQuasiExplicit
+	if err := quasi.Fit(MarketDataFromStrikes(5066.5, []*MarketDataOld{
+		{StrikePrice: 3500, ImVol: 0.31203},
+		{StrikePrice: 4000, ImVol: 0.25041},
+		{StrikePrice: 4500, ImVol: 0.19897},
+		{StrikePrice: 5000, ImVol: 0.15795},
+		{StrikePrice: 5500, ImVol: 0.13803},
+		{StrikePrice: 6000, ImVol: 0.14575},
+		{StrikePrice: 6400, ImVol: 0.17007},
+	})); err != nil || quasi.A < 0 {
+		t.Fatalf("params: %+v, err: %v", quasi.Params, err)
+	}
+	for _, md := range quasi.MarketDataList {
+		if iv := quasi.ImVol(md.K); math.Abs(iv-math.Sqrt(md.V)) > 0.01 {
+			t.Errorf("k=%v: iv %v, market %v", md.K, iv, math.Sqrt(md.V))
+		}
+	}
+}
+
+func TestApplyWeights(t *testing.T) {
+	T := 30.0 / 365
+	list := []*MarketData{
+		{K: -0.3, V: 0.09, Spread: 0.02, OpenInterest: 10},
+		{K: 0, V: 0.04, Spread: 0.005, OpenInterest: 300},
+		{K: 0.3, V: 0.06, Spread: 0.01, OpenInterest: 20},
+	}
+	if err := ApplyWeights(list, WeightVega, T); err != nil || list[1].W <= list[0].W || list[1].W <= list[2].W {
+		t.Errorf("vega weights: %v, %v, %v, err: %v", list[0].W, list[1].W, list[2].W, err)
+	}
+	if err := ApplyWeights(list, WeightSpread, T); err != nil || list[0].W != 1/(0.02*0.02) || list[1].W != 1/(0.005*0.005) {
+		t.Errorf("spread weights: %v, %v, err: %v", list[0].W, list[1].W, err)
+	}
+	if err := ApplyWeights(list, WeightOpenInterest, T); err != nil || list[1].W != 300 {
+		t.Errorf("open interest weights: %v, err: %v", list[1].W, err)
+	}
+	// 持仓量为0时权重为0, 而不是视为等权
+	list[0].OpenInterest = 0
+	if err := ApplyWeights(list, WeightOpenInterest, T); err != nil || list[0].weight() != 0 || list[2].weight() != 20 {
+		t.Errorf("zero open interest weights: %v, %v, err: %v", list[0].weight(), list[2].weight(), err)
+	}
+	// 数据无效时不修改已有权重
+	list[2].Spread = 0
+	if err := ApplyWeights(list, WeightSpread, T); err != ErrInvalidWeight || list[1].W != 300 {
+		t.Errorf("err: %v, weight %v", err, list[1].W)
+	}
+	if err := ApplyWeights(list, "", T); err != ErrInvalidWeight {
+		t.Errorf("err: %v, want %v", err, ErrInvalidWeight)
+	}
+}
+
+func TestWeightedFit(t *testing.T) {
+	// 右翼有一个异常点, 权重很小时各拟合方法都应忽略它
+	T := 30.0 / 365
+	want := &Params{A: 0.01, B: 0.1, C: 0.2, Rho: -0.4, Eta: 0.05}
+	raw := NewVolatility(T)
+	list := make([]*MarketData, 0)
+	for _, k := range []float64{-0.4, -0.3, -0.2, -0.1, -0.05, 0, 0.05, 0.1, 0.2, 0.3, 0.4} {
+		list = append(list, &MarketData{K: k, V: raw.GetVariance(k, want) / T})
+	}
+	outlier := list[len(list)-1]
+	outlier.V *= 1.5
+	outlier.W, outlier.Weighted = 0, true
+
+	check := func(name string, imVol func(k float64) float64) {
+		for _, md := range list[:len(list)-1] {
+			if iv := imVol(md.K); math.Abs(iv-math.Sqrt(md.V)) > 1e-4 {
+				t.Errorf("%s k=%v: iv %v, market %v", name, md.K, iv, math.Sqrt(md.V))
+			}
+		}
+	}
+	lm, quasi, jw := NewVolatility(T), NewVolatility(T), NewSviJW(T)
+	quasi.FitMode = FitModeQuasiExplicit
+	for name, model := range map[string]SmileModel{"lm": lm, "quasi-explicit": quasi, "svi-jw": jw} {
+		if err := model.Fit(list); err != nil {
+			t.Fatalf("%s fit err: %v", name, err)
+		}
+		check(name, model.ImVol)
+	}
+	constrained := NewVolatility(T)
+	if _, _, err := constrained.MinimizeConstrained(list); err != nil {
+		t.Fatalf("constrained err: %v", err)
+	}
+	check("constrained", constrained.ImVol)
+
+	// 等权时异常点会拉动曲线
+	outlier.Weighted = false
+	if err := lm.Fit(list); err != nil {
+		t.Fatalf("lm fit err: %v", err)
+	}
+	if iv := lm.ImVol(0.3); math.Abs(iv-math.Sqrt(list[9].V)) < 1e-4 {
+		t.Errorf("unweighted fit ignores outlier: iv %v", iv)
+	}
+
+	// 数据长度与 MarketDataList 不一致时等权
+	for j, w := range lm.sqrtWeights(len(list) - 1) {
+		if w != 1 {
+			t.Errorf("mismatched length weight %d: %v, want 1", j, w)
+		}
+	}
+	n := len(list) - 1
+	x, y := mat.NewVecDense(n, nil), mat.NewVecDense(n, nil)
+	for j, md := range list[:n] {
+		x.SetVec(j, md.K)
+		y.SetVec(j, math.Sqrt(md.V))
+	}
+	start := want.Copy()
+	start.A, start.Rho = 0.012, -0.35
+	p := lm.LMFit(x, y, start)
+	for _, md := range list[:n] {
+		if iv := lm.GetImVol(md.K, p); math.Abs(iv-math.Sqrt(md.V)) > 1e-4 {
+			t.Errorf("LMFit with mismatched length k=%v: iv %v, market %v", md.K, iv, math.Sqrt(md.V))
+		}
+	}
+}
+
+func TestVolatility_BandFit(t *testing.T) {
+	T := 30.0 / 365
+	want := &Params{A: 0.01, B: 0.1, C: 0.2, Rho: -0.4, Eta: 0.05}
+	s := NewVolatility(T)
+	list := make([]*MarketData, 0)
+	for i, k := range []float64{-0.4, -0.3, -0.2, -0.1, -0.05, 0, 0.05, 0.1, 0.2, 0.3, 0.4} {
+		iv := s.GetImVol(k, want)
+		// 报价区间不对称, 中点不在曲线上
+		bid, ask := iv-0.002, iv+0.01
+		if i%2 == 0 {
+			bid, ask = iv-0.01, iv+0.002
+		}
+		list = append(list, &MarketData{K: k, V: (bid + ask) * (bid + ask) / 4, BidV: bid * bid, AskV: ask * ask})
+	}
+	s.FitMode = FitModeBand
+	if err := s.Fit(list); err != nil {
+		t.Fatalf("fit err: %v", err)
+	}
+	if !s.BandReport.Inside() {
+		for _, v := range s.BandReport.Violations {
+			t.Errorf("violation: %+v", v)
+		}
+	}
+	if report := CheckBands(s, list); !report.Inside() {
+		t.Errorf("CheckBands violations: %v", report.Violations)
+	}
+
+	// 平值附近的区间明显偏离微笑, 无法同时满足, 报告该点
+	atm := list[5]
+	iv := math.Sqrt(atm.V)
+	atm.BidV, atm.AskV = (iv+0.05)*(iv+0.05), (iv+0.051)*(iv+0.051)
+	if err := s.Fit(list); err != nil {
+		t.Fatalf("fit err: %v", err)
+	}
+	found := false
+	for _, v := range s.BandReport.Violations {
+		if v.K == atm.K {
+			found = v.Distance < 0 && v.Bid == iv+0.05
+		}
+	}
+	if !found {
+		t.Errorf("atm violation not reported: %v", s.BandReport.Violations)
+	}
+
+	// 只有买价时区间上方无限制, 都为0时退化为 V
+	if bid, ask := (&MarketData{BidV: 0.04}).band(); bid != 0.2 || !math.IsInf(ask, 1) {
+		t.Errorf("bid only band: %v, %v", bid, ask)
+	}
+	if bid, ask := (&MarketData{V: 0.04}).band(); bid != 0.2 || ask != 0.2 {
+		t.Errorf("mid band: %v, %v", bid, ask)
+	}
+}
+
+func TestVolatility_FitReport(t *testing.T) {
+	T := 30.0 / 365
+	want := &Params{A: 0.01, B: 0.1, C: 0.2, Rho: -0.4, Eta: 0.05}
+	s := NewVolatility(T)
+	list := make([]*MarketData, 0)
+	for i, k := range []float64{-0.4, -0.3, -0.2, -0.1, -0.05, 0, 0.05, 0.1, 0.2, 0.3, 0.4} {
+		// 交替加入噪声
+		iv := s.GetImVol(k, want) + 0.002*float64(1-2*(i%2))
+		list = append(list, &MarketData{K: k, V: iv * iv})
+	}
+	for _, mode := range []string{FitModeLM, FitModeQuasiExplicit, FitModeBand} {
+		s.FitMode = mode
+		s.InitParams(list)
+		p, report := s.FitVol()
+		if p == nil || s.FitReport != report || report.Termination != TerminationConverged || report.Iterations == 0 || report.SolveFailed {
+			t.Fatalf("%q: params %+v, report: %+v", mode, p, report)
+		}
+		if len(report.Residuals) != len(list) || len(report.PriceResiduals) != len(list) {
+			t.Fatalf("%q: report: %+v", mode, report)
+		}
+		sum, max := 0.0, 0.0
+		for i, md := range list {
+			r := s.GetImVol(md.K, p) - math.Sqrt(md.V)
+			if r != report.Residuals[i] || r*report.PriceResiduals[i] < 0 {
+				t.Errorf("%q k=%v: residual %v, price residual %v, want %v", mode, md.K, report.Residuals[i], report.PriceResiduals[i], r)
+			}
+			sum, max = sum+r*r, math.Max(max, math.Abs(r))
+		}
+		if math.Abs(report.RMSE-math.Sqrt(sum/float64(len(list)))) > 1e-15 || report.MaxResidual != max || (mode != FitModeBand && report.RMSE > 0.003) {
+			t.Errorf("%q: rmse %v, max residual %v", mode, report.RMSE, report.MaxResidual)
+		}
+		if !(report.ConditionNumber >= 1) || math.IsInf(report.ConditionNumber, 1) {
+			t.Errorf("%q: condition number %v", mode, report.ConditionNumber)
+		}
+	}
+
+	// 没有初值时不拟合
+	s = NewVolatility(T)
+	s.Params = &Params{}
+	if p, report := s.FitVol(); p != s.Params || report.Termination != TerminationNotFitted {
+		t.Errorf("params %+v, report: %+v", p, report)
+	}
+	// 总方差全部相同时无法给出初值, Fit 返回 ErrNotFitted 并保留之前的参数
+	good := &Params{A: 0.01, B: 0.1, C: 0.2, Rho: -0.4, Eta: 0.05}
+	s.Params = good
+	flat := make([]*MarketData, 0)
+	for _, k := range []float64{-0.2, -0.1, 0, 0.1, 0.2, 0.3} {
+		flat = append(flat, &MarketData{K: k, V: 0.04})
+	}
+	if err := s.Fit(flat); err != ErrNotFitted || s.Params != good || s.FitReport.Termination != TerminationNotFitted {
+		t.Errorf("flat fit err: %v, params: %+v, report: %+v", err, s.Params, s.FitReport)
+	}
+
+	// 被蝶式套利检查拒绝
+	vogt := &Params{A: -0.0410, B: 0.1331, C: 0.4153, Rho: 0.3060, Eta: 0.3586}
+	list = list[:0]
+	for _, k := range []float64{-1, -0.5, -0.2, 0, 0.2, 0.5, 0.8, 1, 1.2, 1.5} {
+		list = append(list, &MarketData{K: k, V: Variance(k-vogt.Eta, vogt.A, vogt.B, vogt.C, vogt.Rho)})
+	}
+	s = NewVolatility(1)
+	s.Arbitrage = ArbitrageReject
+	s.InitParams(list)
+	if p, report := s.FitVol(); p != nil || report.Termination != TerminationButterflyArbitrage {
+		t.Errorf("params %+v, report: %+v", p, report)
+	}
+}
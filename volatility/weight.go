@@ -0,0 +1,55 @@
+package volatility
+
+import (
+	"errors"
+	"math"
+)
+
+const (
+	WeightVega         = "vega"          // 按远期为1的 Black vega 加权, 平值附近的点权重大
+	WeightSpread       = "spread"        // 按 1/Spread^2 加权, 价差越宽权重越小
+	WeightOpenInterest = "open_interest" // 按持仓量加权
+)
+
+var ErrInvalidWeight = errors.New("volatility: invalid weight scheme or market data")
+
+// 拟合时残差平方的权重, 未设置 Weighted 时为1, 否则为 W(可以为0)
+func (md *MarketData) weight() float64 {
+	if !md.Weighted {
+		return 1
+	}
+	return md.W
+}
+
+// 按权重方案计算每个数据点的 W, T 为期限, 仅 WeightVega 使用
+// WeightSpread 要求 Spread>0, WeightOpenInterest 要求 OpenInterest>=0, 持仓量为0的点权重为0
+func ApplyWeights(marketDataList []*MarketData, scheme string, T float64) error {
+	weights := make([]float64, len(marketDataList))
+	for i, md := range marketDataList {
+		switch scheme {
+		case WeightVega:
+			iv := math.Sqrt(md.V)
+			if !(iv > 0) || !(T > 0) {
+				return ErrInvalidWeight
+			}
+			d1 := (-md.K + md.V*T/2) / (iv * math.Sqrt(T))
+			weights[i] = math.Exp(-d1*d1/2) / math.Sqrt(2*math.Pi) * math.Sqrt(T)
+		case WeightSpread:
+			if !(md.Spread > 0) {
+				return ErrInvalidWeight
+			}
+			weights[i] = 1 / (md.Spread * md.Spread)
+		case WeightOpenInterest:
+			if md.OpenInterest < 0 {
+				return ErrInvalidWeight
+			}
+			weights[i] = md.OpenInterest
+		default:
+			return ErrInvalidWeight
+		}
+	}
+	for i, md := range marketDataList {
+		md.W, md.Weighted = weights[i], true
+	}
+	return nil
+}